@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Коды ошибок API
+const (
+	errCodeRouteNotFound        = "route_not_found"
+	errCodeOrderNotFound        = "order_not_found"
+	errCodeReportNotFound       = "report_not_found"
+	errCodeDeadLetterNotFound   = "dead_letter_not_found"
+	errCodeMethodNotAllowed     = "method_not_allowed"
+	errCodeInvalidParameter     = "invalid_parameter"
+	errCodeNotAcceptable        = "not_acceptable"
+	errCodeUnsupportedMediaType = "unsupported_media_type"
+	errCodeInvalidBody          = "invalid_body"
+	errCodeRequestTooLarge      = "request_too_large"
+	errCodeStorageUnavailable   = "storage_unavailable"
+	errCodeInternal             = "internal_error"
+)
+
+// Ограничения размера страницы списка заказов
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Ограничения количества результатов поиска
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Ошибка API. Все ответы с ошибками имеют вид {"error": {...}}.
+type apiError struct {
+	Code    string `json:"code"`            // Машиночитаемый код ошибки
+	Message string `json:"message"`         // Описание ошибки для человека
+	Field   string `json:"field,omitempty"` // Параметр запроса, вызвавший ошибку
+}
+
+// Конверт ответа с ошибкой
+type apiErrorEnvelope struct {
+	Error apiError `json:"error"`
+}
+
+// Функция записи ответа с ошибкой в едином формате
+func writeAPIError(w http.ResponseWriter, status int, apiErr apiError) {
+	writeJSON(w, status, apiErrorEnvelope{Error: apiErr})
+}
+
+// Результаты поиска заказов
+type searchResults struct {
+	Orders []Order `json:"orders"` // Заказы в порядке убывания релевантности
+	Source string  `json:"source"` // Источник результатов: cache или db
+}
+
+// Страница списка заказов
+type orderPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"` // Курсор следующей страницы, пусто на последней странице
+}
+
+// Функция регистрации обработчиков REST API заказов.
+// Каждый маршрут принимает только перечисленные методы, остальные получают 405 с заголовком Allow;
+// HEAD обрабатывается так же, как GET, но без тела ответа.
+func registerAPIHandlers(mux *http.ServeMux) {
+	mux.Handle("/api/v1/orders/{uid}", allowMethods(getOrderByUIDHandler, http.MethodGet, http.MethodHead))
+	mux.Handle("/api/v1/orders", allowMethods(listOrdersHandler, http.MethodGet, http.MethodHead))
+	mux.Handle("/api/v1/orders:batchGet", allowMethods(batchGetOrdersHandler, http.MethodPost))
+	mux.Handle("/api/v1/orders/search", allowMethods(searchOrdersHandler, http.MethodGet, http.MethodHead))
+	mux.Handle("/api/v1/orders/by-track/{track}", allowMethods(listOrdersByHandler("track", "track_number"), http.MethodGet, http.MethodHead))
+	mux.Handle("/api/v1/orders/by-transaction/{transaction}", allowMethods(listOrdersByHandler("transaction", "payment.transaction"), http.MethodGet, http.MethodHead))
+	mux.Handle("/api/v1/customers/{id}/orders", allowMethods(listOrdersByHandler("id", "customer_id"), http.MethodGet, http.MethodHead))
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, apiError{Code: errCodeRouteNotFound, Message: "Маршрут не найден"})
+	})
+	// Прежний адрес сохранён для совместимости и обслуживается тем же кодом, что и /api/v1/orders/{uid}
+	mux.Handle("/order", allowMethods(getOrderHandler, http.MethodGet, http.MethodHead))
+}
+
+// Функция ограничения методов, допустимых для маршрута
+func allowMethods(handler http.HandlerFunc, methods ...string) http.Handler {
+	allow := strings.Join(methods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range methods {
+			if r.Method == method {
+				handler(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", allow)
+		writeAPIError(w, http.StatusMethodNotAllowed, apiError{
+			Code:    errCodeMethodNotAllowed,
+			Message: "Метод " + r.Method + " не поддерживается, допустимы: " + allow,
+		})
+	})
+}
+
+// Обработчик получения заказа по order_uid из пути запроса
+func getOrderByUIDHandler(w http.ResponseWriter, r *http.Request) {
+	serveOrder(w, r, r.PathValue("uid"))
+}
+
+// Функция ответа на запрос заказа.
+// Заказ, отсутствующий в кеше, ищется в хранилище (см. loadOrder); если клиент
+// отключился, ожидание результата прерывается. Ответ берётся из кеша в готовом виде
+// и поддерживает If-None-Match и сжатие gzip.
+func serveOrder(w http.ResponseWriter, r *http.Request, orderID string) {
+	if !acceptsJSON(r.Header.Get("Accept")) {
+		writeAPIError(w, http.StatusNotAcceptable, apiError{Code: errCodeNotAcceptable, Message: "Ответ доступен только в формате application/json"})
+		return
+	}
+	if apiErr, ok := checkOrderUID(orderID); !ok {
+		writeAPIError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	encoded, ok := orderCache.GetEncoded(orderID)
+
+	if !ok {
+		order, err := loadOrder(r.Context(), orderID)
+		if errors.Is(err, ErrOrderNotFound) {
+			writeAPIError(w, http.StatusNotFound, apiError{Code: errCodeOrderNotFound, Message: "Заказ не найден"})
+			return
+		}
+		if err != nil {
+			log.Printf("Ошибка получения заказа %s из хранилища: %v", orderID, err)
+			writeAPIError(w, http.StatusServiceUnavailable, apiError{Code: errCodeStorageUnavailable, Message: "Хранилище заказов недоступно"})
+			return
+		}
+		// Заказ мог не задержаться в кеше, например если он больше cache.max_bytes
+		if encoded, ok = orderCache.GetEncoded(orderID); !ok {
+			if encoded, err = encodeOrder(order, -1); err != nil {
+				log.Printf("Ошибка кодирования заказа %s: %v", orderID, err)
+				writeAPIError(w, http.StatusInternalServerError, apiError{Code: errCodeInternal, Message: "Ошибка формирования ответа"})
+				return
+			}
+		}
+	}
+
+	// Отправить данные заказа в ответ на HTTP-запрос
+	writeEncodedOrder(w, r, encoded)
+}
+
+// Функция проверки order_uid из запроса
+func checkOrderUID(orderID string) (apiError, bool) {
+	if _, message := orderUIDViolation(orderID); message != "" {
+		return apiError{Code: errCodeInvalidParameter, Message: message, Field: "id"}, false
+	}
+	return apiError{}, true
+}
+
+// Источники списка заказов
+const (
+	listSourceDB    = "db"    // Все заказы хранилища
+	listSourceCache = "cache" // Только заказы в кеше, без обращения к хранилищу
+)
+
+// Обработчик получения страницы заказов.
+// Параметры: customer_id, delivery_service, entry, locale, track_number, payment.currency,
+// payment.provider, payment.transaction (точное совпадение), created_from и created_to
+// (диапазон date_created в RFC3339 или ГГГГ-ММ-ДД, правая граница не включается), sort (order_uid, date_created, со знаком "-" по убыванию),
+// source (db или cache), limit и cursor из next_cursor предыдущей страницы.
+// Порядок и курсоры одинаковы для обоих источников.
+func listOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if !acceptsJSON(r.Header.Get("Accept")) {
+		writeAPIError(w, http.StatusNotAcceptable, apiError{Code: errCodeNotAcceptable, Message: "Ответ доступен только в формате application/json"})
+		return
+	}
+	query, source, apiErr, ok := parseListQuery(r)
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	var orders []Order
+	if source == listSourceCache {
+		orders = selectOrderPage(orderCache.Candidates(query.Filter), query)
+	} else {
+		ctx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+		var err error
+		if orders, err = repo.List(ctx, query); err != nil {
+			log.Printf("Ошибка получения списка заказов: %v", err)
+			writeAPIError(w, http.StatusServiceUnavailable, apiError{Code: errCodeStorageUnavailable, Message: "Хранилище заказов недоступно"})
+			return
+		}
+	}
+
+	page := orderPage{Orders: orders}
+	if page.Orders == nil {
+		page.Orders = []Order{}
+	}
+	if len(orders) == query.Limit {
+		page.NextCursor = encodeListCursor(query, orders[len(orders)-1])
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// Обработчик полнотекстового поиска заказов по товарам (название, бренд), получателю и городу.
+// Параметры: q (слова через пробел, префикс поле: ограничивает поиск полем, например brand:Nike),
+// limit и source: cache - только заказы в кеше, db - все заказы хранилища; по умолчанию
+// используется кеш, а если в нём найдено меньше limit заказов, поиск выполняется в хранилище.
+func searchOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if !acceptsJSON(r.Header.Get("Accept")) {
+		writeAPIError(w, http.StatusNotAcceptable, apiError{Code: errCodeNotAcceptable, Message: "Ответ доступен только в формате application/json"})
+		return
+	}
+	query, err := parseSearchQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiError{Code: errCodeInvalidParameter, Message: err.Error(), Field: "q"})
+		return
+	}
+	if query.Limit, err = queryInt(r, "limit", defaultSearchLimit); err != nil || query.Limit < 1 || query.Limit > maxSearchLimit {
+		writeAPIError(w, http.StatusBadRequest, apiError{
+			Code:    errCodeInvalidParameter,
+			Message: "limit должен быть числом в диапазоне 1-" + strconv.Itoa(maxSearchLimit),
+			Field:   "limit",
+		})
+		return
+	}
+	searcher, searchable := repo.(OrderSearcher)
+
+	results := searchResults{Source: listSourceCache}
+	switch source := r.URL.Query().Get("source"); source {
+	case "", listSourceCache:
+		results.Orders = orderCache.Search(query)
+		if source == listSourceCache || len(results.Orders) == query.Limit || !searchable {
+			break
+		}
+		fallthrough
+	case listSourceDB:
+		if !searchable {
+			writeAPIError(w, http.StatusBadRequest, apiError{Code: errCodeInvalidParameter, Message: "Хранилище не поддерживает полнотекстовый поиск", Field: "source"})
+			return
+		}
+		ctx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+		if results.Orders, err = searcher.Search(ctx, query); err != nil {
+			log.Printf("Ошибка поиска заказов в хранилище: %v", err)
+			writeAPIError(w, http.StatusServiceUnavailable, apiError{Code: errCodeStorageUnavailable, Message: "Хранилище заказов недоступно"})
+			return
+		}
+		results.Source = listSourceDB
+	default:
+		writeAPIError(w, http.StatusBadRequest, apiError{Code: errCodeInvalidParameter, Message: "source должен быть db или cache", Field: "source"})
+		return
+	}
+
+	if results.Orders == nil {
+		results.Orders = []Order{}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// Функция создания обработчика списка заказов с условием отбора из пути запроса.
+// Значение параметра пути pathName подставляется в условие param, остальные параметры
+// такие же, как у /api/v1/orders; в кеше такие списки строятся по вторичным индексам.
+func listOrdersByHandler(pathName, param string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value := r.PathValue(pathName)
+		if value == "" || len(value) > maxOrderUIDLength {
+			writeAPIError(w, http.StatusBadRequest, apiError{
+				Code:    errCodeInvalidParameter,
+				Message: "Значение " + param + " должно быть непустым и не длиннее " + strconv.Itoa(maxOrderUIDLength) + " байт",
+				Field:   param,
+			})
+			return
+		}
+		values := r.URL.Query()
+		values.Set(param, value)
+		r.URL.RawQuery = values.Encode()
+		listOrdersHandler(w, r)
+	}
+}
+
+// Функция разбора параметров запроса списка заказов
+func parseListQuery(r *http.Request) (ListQuery, string, apiError, bool) {
+	values := r.URL.Query()
+	invalid := func(field, message string) (ListQuery, string, apiError, bool) {
+		return ListQuery{}, "", apiError{Code: errCodeInvalidParameter, Message: message, Field: field}, false
+	}
+
+	query := ListQuery{Filter: OrderFilter{
+		CustomerID:      values.Get("customer_id"),
+		DeliveryService: values.Get("delivery_service"),
+		Entry:           values.Get("entry"),
+		Locale:          values.Get("locale"),
+		Currency:        values.Get("payment.currency"),
+		Provider:        values.Get("payment.provider"),
+		TrackNumber:     values.Get("track_number"),
+		Transaction:     values.Get("payment.transaction"),
+	}}
+
+	var err error
+	for _, bound := range []struct {
+		name   string
+		target *time.Time
+	}{{"created_from", &query.Filter.CreatedFrom}, {"created_to", &query.Filter.CreatedTo}} {
+		if *bound.target, err = parseTimeParam(values.Get(bound.name)); err != nil {
+			return invalid(bound.name, bound.name+" должен быть временем в RFC3339 или датой ГГГГ-ММ-ДД")
+		}
+	}
+
+	sortBy := values.Get("sort")
+	query.Descending = strings.HasPrefix(sortBy, "-")
+	query.Sort = strings.TrimPrefix(sortBy, "-")
+	if query.Sort != "" && query.Sort != SortByUID && query.Sort != SortByCreated {
+		return invalid("sort", "sort должен быть order_uid или date_created, со знаком - для сортировки по убыванию")
+	}
+
+	source := values.Get("source")
+	switch source {
+	case "":
+		source = listSourceDB
+	case listSourceDB, listSourceCache:
+	default:
+		return invalid("source", "source должен быть db или cache")
+	}
+
+	if query.Limit, err = queryInt(r, "limit", defaultPageSize); err != nil || query.Limit < 1 || query.Limit > maxPageSize {
+		return invalid("limit", "limit должен быть числом в диапазоне 1-"+strconv.Itoa(maxPageSize))
+	}
+	if query.After, err = decodeListCursor(values.Get("cursor"), query); err != nil {
+		return invalid("cursor", err.Error())
+	}
+	return query, source, apiError{}, true
+}
+
+// Функция разбора момента времени из параметра запроса, пустое значение даёт нулевое время
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// Функция проверки, что клиент принимает ответ в JSON.
+// Пустой заголовок Accept означает согласие на любой формат.
+func acceptsJSON(accept string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
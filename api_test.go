@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Функция проверки ответа с ошибкой API в едином формате
+func expectAPIError(t *testing.T, recorder *httptest.ResponseRecorder, code string) {
+	t.Helper()
+	if ct := recorder.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Ожидался Content-Type application/json, получено: %s", ct)
+	}
+	var envelope apiErrorEnvelope
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("Ответ не является ошибкой в формате JSON: %v, тело: %s", err, recorder.Body)
+	}
+	if envelope.Error.Code != code || envelope.Error.Message == "" {
+		t.Errorf("Ожидалась ошибка с кодом %s, получено: %+v", code, envelope.Error)
+	}
+}
+
+// Функция создания маршрутизатора с обработчиками API
+func newTestAPIMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	registerAPIHandlers(mux)
+	return mux
+}
+
+func TestAPIGetOrder(t *testing.T) {
+	useTestCache(t)
+	useTestRepository(t, newMemoryRepository())
+	order := newTestOrder("api-order")
+	orderCache.Set(order)
+	mux := newTestAPIMux()
+
+	for _, target := range []string{"/api/v1/orders/api-order", "/order?id=api-order"} {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: ожидался код %d, получено %d", target, http.StatusOK, recorder.Code)
+		}
+		var got Order
+		if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil || got.OrderUID != order.OrderUID {
+			t.Errorf("%s: неверный заказ в ответе: %+v, ошибка %v", target, got, err)
+		}
+	}
+
+	// HEAD возвращает те же заголовки без тела
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodHead, "/api/v1/orders/api-order", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.Len() != 0 || recorder.Header().Get("Content-Length") == "" || recorder.Header().Get("ETag") == "" {
+		t.Errorf("Неверный ответ на HEAD: код %d, тело %d байт, заголовки %v", recorder.Code, recorder.Body.Len(), recorder.Header())
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	useTestCache(t)
+	useTestRepository(t, newMemoryRepository())
+	orderCache.Set(newTestOrder("api-order"))
+	mux := newTestAPIMux()
+
+	cases := []struct {
+		method, target, accept string
+		status                 int
+		code                   string
+	}{
+		{http.MethodGet, "/api/v1/orders/missing", "", http.StatusNotFound, errCodeOrderNotFound},
+		{http.MethodGet, "/order?id=missing", "", http.StatusNotFound, errCodeOrderNotFound},
+		{http.MethodGet, "/order", "", http.StatusBadRequest, errCodeInvalidParameter},
+		{http.MethodGet, "/api/v1/orders/" + strings.Repeat("x", maxOrderUIDLength+1), "", http.StatusBadRequest, errCodeInvalidParameter},
+		{http.MethodGet, "/api/v1/orders/bad%20id", "", http.StatusBadRequest, errCodeInvalidParameter},
+		{http.MethodPost, "/api/v1/orders/api-order", "", http.StatusMethodNotAllowed, errCodeMethodNotAllowed},
+		{http.MethodDelete, "/order?id=api-order", "", http.StatusMethodNotAllowed, errCodeMethodNotAllowed},
+		{http.MethodPut, "/api/v1/orders", "", http.StatusMethodNotAllowed, errCodeMethodNotAllowed},
+		{http.MethodGet, "/api/v1/orders/api-order", "text/html", http.StatusNotAcceptable, errCodeNotAcceptable},
+		{http.MethodGet, "/api/v1/orders/api-order", "application/json;q=0", http.StatusNotAcceptable, errCodeNotAcceptable},
+		{http.MethodGet, "/api/v1/orders?limit=0", "", http.StatusBadRequest, errCodeInvalidParameter},
+		{http.MethodGet, "/api/v1/orders?cursor=***", "", http.StatusBadRequest, errCodeInvalidParameter},
+		{http.MethodGet, "/api/v1/orders?sort=amount", "", http.StatusBadRequest, errCodeInvalidParameter},
+		{http.MethodGet, "/api/v1/orders?created_from=вчера", "", http.StatusBadRequest, errCodeInvalidParameter},
+		{http.MethodGet, "/api/v1/orders?source=nats", "", http.StatusBadRequest, errCodeInvalidParameter},
+		{http.MethodGet, "/api/v1/unknown", "", http.StatusNotFound, errCodeRouteNotFound},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, nil)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		if recorder.Code != c.status {
+			t.Errorf("%s %s: ожидался код %d, получено %d", c.method, c.target, c.status, recorder.Code)
+			continue
+		}
+		expectAPIError(t, recorder, c.code)
+		if c.status == http.StatusMethodNotAllowed && recorder.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("%s %s: неверный заголовок Allow: %q", c.method, c.target, recorder.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestAcceptsJSON(t *testing.T) {
+	cases := map[string]bool{
+		"":                                      true,
+		"application/json":                      true,
+		"*/*":                                   true,
+		"text/html, application/*;q=0.5":        true,
+		"application/json; charset=utf-8":       true,
+		"text/html":                             false,
+		"application/xml, application/json;q=0": false,
+	}
+	for accept, want := range cases {
+		if got := acceptsJSON(accept); got != want {
+			t.Errorf("Accept %q: ожидалось %v, получено %v", accept, want, got)
+		}
+	}
+}
+
+func TestAPIListOrders(t *testing.T) {
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	for i := 0; i < 5; i++ {
+		r.Save(context.Background(), newTestOrder(fmt.Sprintf("list-%d", i)), DuplicateIgnore)
+	}
+	mux := newTestAPIMux()
+
+	var uids []string
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/orders?limit=2&cursor="+cursor, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Ожидался код %d, получено %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+		}
+		var page orderPage
+		if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, order := range page.Orders {
+			uids = append(uids, order.OrderUID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if got := strings.Join(uids, ","); got != "list-0,list-1,list-2,list-3,list-4" {
+		t.Errorf("Неверный порядок заказов по страницам: %s", got)
+	}
+	// Отбор, сортировка и источник cache
+	useTestCache(t)
+	for i := 0; i < 5; i++ {
+		order := newTestOrder(fmt.Sprintf("list-%d", i))
+		order.Payment.Currency = []string{"USD", "RUB"}[i%2]
+		orderCache.Set(order)
+	}
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/orders?source=cache&payment.currency=RUB&sort=-order_uid&created_from=2021-11-26", nil))
+	var page orderPage
+	if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil || len(page.Orders) != 2 ||
+		page.Orders[0].OrderUID != "list-3" || page.Orders[1].OrderUID != "list-1" || page.NextCursor != "" {
+		t.Errorf("Неверная страница из кеша: %+v, ошибка %v", page, err)
+	}
+}
+
+func TestAPIListOrdersBySecondaryKeys(t *testing.T) {
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	useTestCache(t)
+	for i := 0; i < 4; i++ {
+		order := newTestOrder(fmt.Sprintf("by-%d", i))
+		order.TrackNumber = []string{"TRACK-A", "TRACK-B"}[i%2]
+		order.CustomerID = []string{"alice", "bob"}[i/2]
+		r.Save(context.Background(), order, DuplicateIgnore)
+		orderCache.Set(order)
+	}
+	mux := newTestAPIMux()
+
+	for target, want := range map[string]string{
+		"/api/v1/orders/by-track/TRACK-A":                 "by-0,by-2",
+		"/api/v1/orders/by-track/TRACK-B?source=cache":    "by-1,by-3",
+		"/api/v1/customers/bob/orders?sort=-order_uid":    "by-3,by-2",
+		"/api/v1/customers/alice/orders?source=cache":     "by-0,by-1",
+		"/api/v1/orders/by-transaction/by-1":              "by-1",
+		"/api/v1/orders/by-transaction/by-2?source=cache": "by-2",
+		"/api/v1/orders/by-track/TRACK-C":                 "",
+	} {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		var page orderPage
+		if err := json.Unmarshal(recorder.Body.Bytes(), &page); err != nil || recorder.Code != http.StatusOK {
+			t.Fatalf("%s: код %d, ошибка %v", target, recorder.Code, err)
+		}
+		var uids []string
+		for _, order := range page.Orders {
+			uids = append(uids, order.OrderUID)
+		}
+		if got := strings.Join(uids, ","); got != want {
+			t.Errorf("%s: ожидалось %s, получено %s", target, want, got)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/customers/alice/orders", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Ожидался код %d, получено %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+}
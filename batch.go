@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Тип содержимого потокового ответа: один JSON-объект на строку
+const ndjsonContentType = "application/x-ndjson"
+
+// Количество order_uid, загружаемых из хранилища одним запросом
+const batchLoadSize = 500
+
+// Тело запроса пакетного получения заказов
+type batchGetRequest struct {
+	OrderUIDs []string `json:"order_uids"`
+}
+
+// Ответ пакетного получения заказов в формате JSON
+type batchGetResponse struct {
+	Orders  []json.RawMessage `json:"orders"`  // Найденные заказы в порядке запроса
+	Missing []string          `json:"missing"` // order_uid, которых нет в хранилище
+}
+
+// Строка потокового ответа: найденный заказ, отсутствующий order_uid или ошибка,
+// после которой ответ завершается
+type batchLine struct {
+	Order   json.RawMessage `json:"order,omitempty"`
+	Missing string          `json:"missing,omitempty"`
+	Error   *apiError       `json:"error,omitempty"`
+}
+
+// Обработчик пакетного получения заказов POST /api/v1/orders:batchGet.
+// Тело запроса: {"order_uids": [...]}, не более http.batch_max_uids идентификаторов;
+// повторы order_uid отбрасываются. Заказы берутся из кеша, отсутствующие в нём загружаются
+// из хранилища пачками по batchLoadSize (см. loadOrders).
+//
+// Если клиент принимает application/x-ndjson, ответ передаётся построчно по мере загрузки
+// пачек, и допустимо до http.batch_stream_max_uids идентификаторов.
+func batchGetOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	stream, ok := batchResponseFormat(r.Header.Get("Accept"))
+	if !ok {
+		writeAPIError(w, http.StatusNotAcceptable, apiError{Code: errCodeNotAcceptable, Message: "Ответ доступен в форматах application/json и " + ndjsonContentType})
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+			writeAPIError(w, http.StatusUnsupportedMediaType, apiError{Code: errCodeUnsupportedMediaType, Message: "Тело запроса должно быть в формате application/json"})
+			return
+		}
+	}
+
+	cfg := currentConfig().HTTP
+	maxUIDs := cfg.BatchMaxUIDs
+	if stream {
+		maxUIDs = cfg.BatchStreamMaxUIDs
+	}
+	// Объём тела ограничен по большему из пределов, чтобы превышение количества идентификаторов
+	// для выбранного формата сообщалось ошибкой с пределом; запас - на кавычки и экранирование
+	bodyUIDs := max(cfg.BatchMaxUIDs, cfg.BatchStreamMaxUIDs)
+	r.Body = http.MaxBytesReader(w, r.Body, int64(bodyUIDs)*(maxOrderUIDLength+16)+1024)
+
+	var req batchGetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, apiError{Code: errCodeRequestTooLarge, Message: "Тело запроса больше " + strconv.FormatInt(tooLarge.Limit, 10) + " байт"})
+			return
+		}
+		writeAPIError(w, http.StatusBadRequest, apiError{Code: errCodeInvalidBody, Message: "Тело запроса должно быть JSON-объектом {\"order_uids\": [...]}: " + err.Error()})
+		return
+	}
+	uids, apiErr, ok := checkBatchUIDs(req.OrderUIDs, maxUIDs)
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, apiErr)
+		return
+	}
+
+	if stream {
+		streamBatchOrders(w, r, uids)
+		return
+	}
+
+	resp := batchGetResponse{Orders: []json.RawMessage{}, Missing: []string{}}
+	for start := 0; start < len(uids); start += batchLoadSize {
+		chunk := uids[start:min(start+batchLoadSize, len(uids))]
+		found, err := loadOrders(r.Context(), chunk)
+		if err != nil {
+			log.Printf("Ошибка пакетного получения заказов из хранилища: %v", err)
+			writeAPIError(w, http.StatusServiceUnavailable, apiError{Code: errCodeStorageUnavailable, Message: "Хранилище заказов недоступно"})
+			return
+		}
+		for _, uid := range chunk {
+			if encoded, ok := found[uid]; ok {
+				resp.Orders = append(resp.Orders, encoded.JSON)
+			} else {
+				resp.Missing = append(resp.Missing, uid)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Функция потоковой передачи заказов построчно в формате NDJSON.
+// Каждая пачка отправляется клиенту сразу после загрузки, а срок записи ответа продлевается
+// на http.write_timeout, чтобы большой пакет не прерывался общим ограничением сервера.
+// Ошибка хранилища после начала ответа передаётся последней строкой {"error": {...}}.
+func streamBatchOrders(w http.ResponseWriter, r *http.Request, uids []string) {
+	rc := http.NewResponseController(w)
+	writeTimeout := currentConfig().HTTP.WriteTimeout
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for start := 0; start < len(uids); start += batchLoadSize {
+		// Не все ResponseWriter поддерживают сроки записи, тогда действует общее ограничение
+		rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+		chunk := uids[start:min(start+batchLoadSize, len(uids))]
+		found, err := loadOrders(r.Context(), chunk)
+		if err != nil {
+			log.Printf("Ошибка пакетного получения заказов из хранилища: %v", err)
+			enc.Encode(batchLine{Error: &apiError{Code: errCodeStorageUnavailable, Message: "Хранилище заказов недоступно"}})
+			return
+		}
+		for _, uid := range chunk {
+			line := batchLine{Missing: uid}
+			if encoded, ok := found[uid]; ok {
+				line = batchLine{Order: encoded.JSON}
+			}
+			if err := enc.Encode(line); err != nil {
+				// Клиент отключился
+				return
+			}
+		}
+		rc.Flush()
+	}
+}
+
+// Функция проверки идентификаторов пакетного запроса с удалением повторов
+func checkBatchUIDs(uids []string, maxUIDs int) ([]string, apiError, bool) {
+	if len(uids) == 0 {
+		return nil, apiError{Code: errCodeInvalidParameter, Message: "Не указаны идентификаторы заказов", Field: "order_uids"}, false
+	}
+	if len(uids) > maxUIDs {
+		return nil, apiError{Code: errCodeInvalidParameter, Message: fmt.Sprintf("В запросе %d идентификаторов, допустимо не более %d", len(uids), maxUIDs), Field: "order_uids"}, false
+	}
+	seen := make(map[string]struct{}, len(uids))
+	unique := make([]string, 0, len(uids))
+	for i, uid := range uids {
+		if apiErr, ok := checkOrderUID(uid); !ok {
+			apiErr.Field = "order_uids[" + strconv.Itoa(i) + "]"
+			return nil, apiErr, false
+		}
+		if _, ok := seen[uid]; !ok {
+			seen[uid] = struct{}{}
+			unique = append(unique, uid)
+		}
+	}
+	return unique, apiError{}, true
+}
+
+// Функция выбора формата ответа пакетного запроса: NDJSON, если клиент явно его принимает,
+// иначе JSON. Возвращает false, если клиент не принимает ни один из форматов.
+func batchResponseFormat(accept string) (stream bool, ok bool) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != ndjsonContentType {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true, true
+	}
+	return false, acceptsJSON(accept)
+}
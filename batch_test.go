@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Функция выполнения пакетного запроса с указанным телом и заголовком Accept
+func postBatchGet(mux *http.ServeMux, body, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orders:batchGet", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestAPIBatchGetOrders(t *testing.T) {
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	useTestCache(t)
+	missingOrders = newNegativeCache()
+	orderCache.Set(newTestOrder("batch-cached"))
+	r.Save(context.Background(), newTestOrder("batch-stored"), DuplicateIgnore)
+	mux := newTestAPIMux()
+
+	recorder := postBatchGet(mux, `{"order_uids": ["batch-stored", "batch-missing", "batch-cached", "batch-stored"]}`, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Ожидался код %d, получено %d: %s", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	var resp struct {
+		Orders  []Order  `json:"orders"`
+		Missing []string `json:"missing"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := joinUIDs(resp.Orders); got != "batch-stored,batch-cached" || strings.Join(resp.Missing, ",") != "batch-missing" {
+		t.Errorf("Ожидались заказы batch-stored,batch-cached и отсутствующий batch-missing, получено: %s и %v", got, resp.Missing)
+	}
+	// Заказ из хранилища добавлен в кеш, отсутствующий запомнен
+	if _, ok := orderCache.Get("batch-stored"); !ok {
+		t.Error("Заказ из хранилища должен быть добавлен в кеш")
+	}
+	if !missingOrders.has("batch-missing") {
+		t.Error("Отсутствующий заказ должен быть запомнен в кеше отсутствующих")
+	}
+}
+
+func TestAPIBatchGetOrdersStream(t *testing.T) {
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	useTestCache(t)
+	missingOrders = newNegativeCache()
+	useTestConfig(t, func(cfg *Config) { cfg.HTTP.BatchMaxUIDs = 10 })
+
+	// Идентификаторов больше batchLoadSize и http.batch_max_uids, каждый третий сохранён
+	uids := make([]string, 2*batchLoadSize+10)
+	for i := range uids {
+		uids[i] = fmt.Sprintf("stream-%04d", i)
+		if i%3 == 0 {
+			r.Save(context.Background(), newTestOrder(uids[i]), DuplicateIgnore)
+		}
+	}
+	body, _ := json.Marshal(batchGetRequest{OrderUIDs: uids})
+	mux := newTestAPIMux()
+
+	if recorder := postBatchGet(mux, string(body), "application/json"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Ответ JSON: ожидался код %d при превышении http.batch_max_uids, получено %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	recorder := postBatchGet(mux, string(body), "application/x-ndjson")
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != ndjsonContentType {
+		t.Fatalf("Ожидался код %d и NDJSON, получено %d, %s", http.StatusOK, recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	scanner := bufio.NewScanner(recorder.Body)
+	scanner.Buffer(nil, 1<<20)
+	i := 0
+	for ; scanner.Scan(); i++ {
+		var line struct {
+			Order   *Order `json:"order"`
+			Missing string `json:"missing"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Строка %d не является JSON: %v", i, err)
+		}
+		if i >= len(uids) {
+			continue
+		}
+		if i%3 == 0 && (line.Order == nil || line.Order.OrderUID != uids[i]) {
+			t.Errorf("Строка %d: ожидался заказ %s, получено %s", i, uids[i], scanner.Text())
+		}
+		if i%3 != 0 && line.Missing != uids[i] {
+			t.Errorf("Строка %d: ожидался отсутствующий %s, получено %s", i, uids[i], scanner.Text())
+		}
+	}
+	if i != len(uids) {
+		t.Errorf("Ожидалось %d строк, получено %d", len(uids), i)
+	}
+}
+
+func TestAPIBatchGetOrdersErrors(t *testing.T) {
+	useTestRepository(t, newMemoryRepository())
+	useTestCache(t)
+	mux := newTestAPIMux()
+
+	cases := []struct {
+		body, accept string
+		status       int
+		code         string
+	}{
+		{`{"order_uids": []}`, "", http.StatusBadRequest, errCodeInvalidParameter},
+		{`{"order_uids": ["ok", "with space"]}`, "", http.StatusBadRequest, errCodeInvalidParameter},
+		{`["a"]`, "", http.StatusBadRequest, errCodeInvalidBody},
+		{`{"order_uids": ["a"]}`, "text/html", http.StatusNotAcceptable, errCodeNotAcceptable},
+		{`{"order_uids": ["` + strings.Repeat("a", 20000000) + `"]}`, "", http.StatusRequestEntityTooLarge, errCodeRequestTooLarge},
+	}
+	for _, c := range cases {
+		recorder := postBatchGet(mux, c.body, c.accept)
+		if recorder.Code != c.status {
+			t.Errorf("%.40s: ожидался код %d, получено %d", c.body, c.status, recorder.Code)
+		}
+		expectAPIError(t, recorder, c.code)
+	}
+
+	var envelope apiErrorEnvelope
+	recorder := postBatchGet(mux, `{"order_uids": ["ok", "with space"]}`, "")
+	if json.Unmarshal(recorder.Body.Bytes(), &envelope); envelope.Error.Field != "order_uids[1]" {
+		t.Errorf("Ожидалось поле order_uids[1], получено %q", envelope.Error.Field)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/orders:batchGet", strings.NewReader(`{"order_uids": ["a"]}`))
+	req.Header.Set("Content-Type", "text/plain")
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Ожидался код %d, получено %d", http.StatusUnsupportedMediaType, recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/orders:batchGet", nil))
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("Ожидался код %d с Allow: POST, получено %d, %q", http.StatusMethodNotAllowed, recorder.Code, recorder.Header().Get("Allow"))
+	}
+}
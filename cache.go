@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Объединение одновременных загрузок одного заказа из хранилища в один запрос
+var orderLoads singleflight.Group
+
+// Функция загрузки заказа, отсутствующего в кеше, из хранилища с добавлением в кеш.
+// Одновременные запросы одного order_uid выполняют один запрос к хранилищу, а отсутствующие
+// в хранилище order_uid запоминаются на cache.negative_ttl, чтобы повторные запросы не доходили до базы.
+func loadOrder(ctx context.Context, orderID string) (Order, error) {
+	if orderID == "" || missingOrders.has(orderID) {
+		return Order{}, ErrOrderNotFound
+	}
+
+	// Общий запрос не привязан к отмене контекста первого клиента, иначе его отключение
+	// завершило бы ошибкой запросы остальных; время запроса ограничено db.query_timeout
+	ch := orderLoads.DoChan(orderID, func() (interface{}, error) {
+		ctx, cancel := withQueryTimeout(context.WithoutCancel(ctx))
+		defer cancel()
+
+		order, err := repo.Get(ctx, orderID)
+		switch {
+		case err == nil:
+			order, _ = cacheLoadedOrder(order)
+		case errors.Is(err, ErrOrderNotFound):
+			missingOrders.add(orderID, currentConfig().Cache.NegativeTTL)
+		}
+		return order, err
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return Order{}, res.Err
+		}
+		return res.Val.(Order), nil
+	case <-ctx.Done():
+		return Order{}, ctx.Err()
+	}
+}
+
+// Функция добавления заказа, прочитанного из хранилища, в кеш.
+// Заказ, уже находящийся в кеше, не заменяется: его могли обновить из брокера после чтения.
+func cacheLoadedOrder(order Order) (Order, *encodedOrder) {
+	missingOrders.remove(order.OrderUID)
+	return orderCache.Add(order)
+}
+
+// Функция загрузки набора заказов для пакетного запроса. Заказы из кеша берутся в готовом виде,
+// остальные загружаются из хранилища одним запросом и добавляются в кеш, если их там ещё нет
+// (см. cacheLoadedOrder); order_uid, недавно не найденные в хранилище, не запрашиваются повторно.
+// Отсутствующих заказов нет в результате.
+func loadOrders(ctx context.Context, uids []string) (map[string]*encodedOrder, error) {
+	found := make(map[string]*encodedOrder, len(uids))
+	var pending []string
+	for _, uid := range uids {
+		if encoded, ok := orderCache.GetEncoded(uid); ok {
+			found[uid] = encoded
+		} else if !missingOrders.has(uid) {
+			pending = append(pending, uid)
+		}
+	}
+	if len(pending) == 0 {
+		return found, nil
+	}
+
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+	orders, err := repo.GetMany(ctx, pending)
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		_, encoded := cacheLoadedOrder(order)
+		if encoded == nil {
+			if encoded, err = encodeOrder(order, -1); err != nil {
+				return nil, fmt.Errorf("ошибка кодирования заказа %s: %w", order.OrderUID, err)
+			}
+		}
+		found[order.OrderUID] = encoded
+	}
+	ttl := currentConfig().Cache.NegativeTTL
+	for _, uid := range pending {
+		if _, ok := found[uid]; !ok {
+			missingOrders.add(uid, ttl)
+		}
+	}
+	return found, nil
+}
+
+// Кеш order_uid, которых нет в хранилище
+type negativeCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time // order_uid -> момент истечения записи
+}
+
+// Отсутствующие в хранилище заказы
+var missingOrders = newNegativeCache()
+
+// Функция создания пустого кеша отсутствующих заказов
+func newNegativeCache() *negativeCache {
+	return &negativeCache{entries: make(map[string]time.Time)}
+}
+
+// Функция проверки, что order_uid недавно не был найден в хранилище
+func (c *negativeCache) has(uid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires, ok := c.entries[uid]
+	if ok && time.Now().After(expires) {
+		delete(c.entries, uid)
+		return false
+	}
+	return ok
+}
+
+// Функция добавления отсутствующего order_uid. При переполнении сначала удаляются
+// истёкшие записи, затем произвольные, чтобы поток случайных идентификаторов не занял всю память.
+func (c *negativeCache) add(uid string, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if maxEntries := currentConfig().Cache.NegativeMaxEntries; len(c.entries) >= maxEntries {
+		now := time.Now()
+		for key, expires := range c.entries {
+			if now.After(expires) {
+				delete(c.entries, key)
+			}
+		}
+		for key := range c.entries {
+			if len(c.entries) < maxEntries {
+				break
+			}
+			delete(c.entries, key)
+		}
+	}
+	c.entries[uid] = time.Now().Add(ttl)
+}
+
+// Функция удаления order_uid, например после сохранения заказа с этим идентификатором
+func (c *negativeCache) remove(uid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, uid)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Хранилище, считающее запросы заказов и задерживающее ответ до закрытия release
+type countingRepository struct {
+	OrderRepository
+	gets    atomic.Int32
+	release chan struct{}
+}
+
+func (r *countingRepository) Get(ctx context.Context, uid string) (Order, error) {
+	r.gets.Add(1)
+	<-r.release
+	return r.OrderRepository.Get(ctx, uid)
+}
+
+func (r *countingRepository) GetMany(ctx context.Context, uids []string) ([]Order, error) {
+	r.gets.Add(1)
+	<-r.release
+	return r.OrderRepository.GetMany(ctx, uids)
+}
+
+func TestLoadOrder_Singleflight(t *testing.T) {
+	memory := newMemoryRepository()
+	order := newTestOrder("singleflight-order")
+	memory.Save(context.Background(), order, DuplicateIgnore)
+	counting := &countingRepository{OrderRepository: memory, release: make(chan struct{})}
+	useTestRepository(t, counting)
+	defer orderCache.Delete(order.OrderUID)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := loadOrder(context.Background(), order.OrderUID)
+			errs <- err
+		}()
+	}
+	// Даём запросам встать в очередь за первым
+	time.Sleep(20 * time.Millisecond)
+	close(counting.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Ошибка загрузки заказа: %v", err)
+		}
+	}
+	if n := counting.gets.Load(); n != 1 {
+		t.Errorf("Ожидался один запрос к хранилищу, получено: %d", n)
+	}
+}
+
+func TestLoadOrder_KeepsNewerCachedOrder(t *testing.T) {
+	memory := newMemoryRepository()
+	stale := newTestOrder("load-race-order")
+	memory.Save(context.Background(), stale, DuplicateIgnore)
+	counting := &countingRepository{OrderRepository: memory, release: make(chan struct{})}
+	useTestRepository(t, counting)
+	useTestCache(t)
+
+	loaded := make(chan Order)
+	go func() {
+		order, _ := loadOrder(context.Background(), stale.OrderUID)
+		loaded <- order
+	}()
+	for counting.gets.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// Пока идёт чтение из хранилища, из брокера приходит новая версия заказа
+	fresh := stale
+	fresh.TrackNumber = "FRESHTRACK"
+	updateOrderCache(fresh)
+	close(counting.release)
+
+	if order := <-loaded; order.TrackNumber != fresh.TrackNumber {
+		t.Errorf("Ожидался заказ из кеша с трек-номером %s, получено: %s", fresh.TrackNumber, order.TrackNumber)
+	}
+	if cached, _ := orderCache.Get(stale.OrderUID); cached.TrackNumber != fresh.TrackNumber {
+		t.Errorf("Прочитанный из хранилища заказ заменил более новый в кеше: %s", cached.TrackNumber)
+	}
+}
+
+func TestLoadOrders_KeepsNewerCachedOrder(t *testing.T) {
+	memory := newMemoryRepository()
+	stale := newTestOrder("load-many-race-order")
+	memory.Save(context.Background(), stale, DuplicateIgnore)
+	counting := &countingRepository{OrderRepository: memory, release: make(chan struct{})}
+	useTestRepository(t, counting)
+	useTestCache(t)
+	missingOrders = newNegativeCache()
+
+	loaded := make(chan map[string]*encodedOrder)
+	go func() {
+		found, _ := loadOrders(context.Background(), []string{stale.OrderUID})
+		loaded <- found
+	}()
+	for counting.gets.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	fresh := stale
+	fresh.TrackNumber = "FRESHTRACK"
+	updateOrderCache(fresh)
+	close(counting.release)
+
+	var order Order
+	if encoded := (<-loaded)[stale.OrderUID]; encoded == nil || json.Unmarshal(encoded.JSON, &order) != nil || order.TrackNumber != fresh.TrackNumber {
+		t.Errorf("Ожидался заказ из кеша с трек-номером %s, получено: %s", fresh.TrackNumber, order.TrackNumber)
+	}
+	if cached, _ := orderCache.Get(stale.OrderUID); cached.TrackNumber != fresh.TrackNumber {
+		t.Errorf("Прочитанный из хранилища заказ заменил более новый в кеше: %s", cached.TrackNumber)
+	}
+}
+
+func TestLoadOrder_NegativeCache(t *testing.T) {
+	counting := &countingRepository{OrderRepository: newMemoryRepository(), release: make(chan struct{})}
+	close(counting.release)
+	useTestRepository(t, counting)
+
+	for i := 0; i < 3; i++ {
+		if _, err := loadOrder(context.Background(), "missing-order"); !errors.Is(err, ErrOrderNotFound) {
+			t.Fatalf("Ожидалась ошибка ErrOrderNotFound, получено: %v", err)
+		}
+	}
+	if n := counting.gets.Load(); n != 1 {
+		t.Errorf("Отсутствующий заказ должен запрашиваться из хранилища один раз, получено: %d", n)
+	}
+
+	// Сохранение заказа снимает отметку об отсутствии
+	order := newTestOrder("missing-order")
+	updateOrderCache(order)
+	defer orderCache.Delete(order.OrderUID)
+	if missingOrders.has(order.OrderUID) {
+		t.Error("Сохранённый заказ не должен считаться отсутствующим")
+	}
+}
+
+func TestNegativeCache_Bounded(t *testing.T) {
+	useTestConfig(t, func(cfg *Config) { cfg.Cache.NegativeMaxEntries = 2 })
+	c := newNegativeCache()
+
+	c.add("a", time.Minute)
+	c.add("b", time.Minute)
+	c.add("c", time.Minute)
+	if len(c.entries) != 2 || !c.has("c") {
+		t.Errorf("Ожидалось не больше 2 записей с последней добавленной, получено: %v", c.entries)
+	}
+
+	c.add("expired", -time.Second)
+	if c.has("expired") {
+		t.Error("Запись с неположительным временем хранения не должна добавляться")
+	}
+}
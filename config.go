@@ -0,0 +1,702 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Конфигурация приложения.
+//
+// Значения собираются из нескольких источников, каждый следующий переопределяет предыдущий:
+//  1. значения по умолчанию (defaultConfig);
+//  2. YAML-файл, путь к которому задаётся флагом -config или переменной ORDERS_CONFIG;
+//  3. переменные окружения ORDERS_*;
+//  4. флаги командной строки.
+//
+// Параметры подключений (NATS, PostgreSQL, адрес HTTP-сервера) читаются только при запуске.
+// Остальные параметры перечитываются по сигналу SIGHUP без перезапуска сервиса.
+type Config struct {
+	NATS     NATSConfig     `yaml:"nats"`
+	DB       DBConfig       `yaml:"db"`
+	Storage  StorageConfig  `yaml:"storage"`
+	HTTP     HTTPConfig     `yaml:"http"`
+	Ingest   IngestConfig   `yaml:"ingest"`
+	Restore  RestoreConfig  `yaml:"restore"`
+	Cache    CacheConfig    `yaml:"cache"`
+	Snapshot SnapshotConfig `yaml:"snapshot"`
+	Sender   SenderConfig   `yaml:"sender"`
+	Shutdown ShutdownConfig `yaml:"shutdown"`
+}
+
+// Параметры подключения к NATS Streaming или JetStream
+type NATSConfig struct {
+	// Транспорт получения заказов: stan (NATS Streaming) или jetstream
+	Transport   string `yaml:"transport"`
+	URL         string `yaml:"url"`
+	ClusterID   string `yaml:"cluster_id"`
+	ClientID    string `yaml:"client_id"`
+	Subject     string `yaml:"subject"`
+	DurableName string `yaml:"durable_name"`
+
+	// Время ожидания подтверждения, после которого сервер доставит сообщение повторно
+	AckWait time.Duration `yaml:"ack_wait"`
+	// Максимальное количество неподтверждённых сообщений в обработке
+	MaxInflight int `yaml:"max_inflight"`
+
+	// Параметры JetStream: поток с заказами, предельное количество доставок
+	// одного сообщения (0 - без ограничения) и задержки перед повторными доставками
+	Stream     string          `yaml:"stream"`
+	MaxDeliver int             `yaml:"max_deliver"`
+	BackOff    []time.Duration `yaml:"backoff"`
+}
+
+// Параметры подключения к PostgreSQL
+type DBConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+
+	// Параметры пула соединений
+	MinConns               int           `yaml:"min_conns"`
+	MaxConns               int           `yaml:"max_conns"`
+	HealthCheckPeriod      time.Duration `yaml:"health_check_period"`
+	MaxConnLifetime        time.Duration `yaml:"max_conn_lifetime"`
+	MaxConnIdleTime        time.Duration `yaml:"max_conn_idle_time"`
+	StatementCacheMode     string        `yaml:"statement_cache_mode"`     // prepare или describe
+	StatementCacheCapacity int           `yaml:"statement_cache_capacity"` // 0 отключает кеш выражений
+	ConnectAttempts        int           `yaml:"connect_attempts"`
+
+	// Применять недостающие миграции схемы при запуске вместо отказа от работы
+	AutoMigrate bool `yaml:"auto_migrate"`
+	// Предельное время одной операции с хранилищем (сохранение, чтение заказа)
+	QueryTimeout time.Duration `yaml:"query_timeout"`
+}
+
+// Параметры хранилища заказов
+type StorageConfig struct {
+	Driver     string `yaml:"driver"`      // postgres, sqlite или memory
+	SQLitePath string `yaml:"sqlite_path"` // путь к файлу базы для driver=sqlite
+}
+
+// Параметры HTTP-сервера
+type HTTPConfig struct {
+	Addr string `yaml:"addr"`
+
+	// Ограничения времени на чтение запроса, запись ответа и простой keep-alive соединения
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+
+	// Предельное количество order_uid в пакетном запросе с ответом JSON и NDJSON
+	BatchMaxUIDs       int `yaml:"batch_max_uids"`
+	BatchStreamMaxUIDs int `yaml:"batch_stream_max_uids"`
+}
+
+// Параметры приёма заказов из NATS
+type IngestConfig struct {
+	// Обработка заказа с уже сохранённым order_uid: ignore, replace или reject-if-different
+	DuplicatePolicy DuplicatePolicy `yaml:"duplicate_policy"`
+	// Количество попыток обработки сообщения, после которого оно подтверждается без сохранения (0 - без ограничения)
+	MaxRedeliveries int `yaml:"max_redeliveries"`
+}
+
+// Параметры восстановления кеша из базы данных
+type RestoreConfig struct {
+	// Источник восстановления: db (хранилище) или replay (повторное чтение канала со сверкой с хранилищем)
+	Source string `yaml:"source"`
+	// Позиция начала чтения канала для source=replay: all, номер сообщения,
+	// время в RFC3339 или длительность назад от момента запуска (например 24h)
+	ReplayFrom string `yaml:"replay_from"`
+	BatchSize  int    `yaml:"batch_size"`
+	// Предельное время восстановления кеша при запуске
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Параметры кеша заказов
+type CacheConfig struct {
+	// Политика вытеснения: lru, lfu или ttl
+	Policy string `yaml:"policy"`
+	// Ограничения количества заказов и приблизительного объёма памяти в байтах, 0 - без ограничения
+	MaxEntries int   `yaml:"max_entries"`
+	MaxBytes   int64 `yaml:"max_bytes"`
+	// Время хранения заказа в кеше, 0 - без ограничения (обязательно для политики ttl)
+	TTL time.Duration `yaml:"ttl"`
+	// Количество независимых сегментов кеша со своими блокировками
+	Shards int `yaml:"shards"`
+	// Минимальная длина JSON заказа, начиная с которой в кеше хранится сжатое gzip представление,
+	// отрицательное значение отключает сжатие
+	GzipMinSize int `yaml:"gzip_min_size"`
+
+	// Время, в течение которого order_uid, отсутствующий в хранилище, не запрашивается повторно
+	NegativeTTL time.Duration `yaml:"negative_ttl"`
+	// Максимальное количество запомненных отсутствующих order_uid
+	NegativeMaxEntries int `yaml:"negative_max_entries"`
+}
+
+// Параметры снимка кеша на локальном диске
+type SnapshotConfig struct {
+	// Путь к файлу снимка, пустая строка отключает снимки
+	Path string `yaml:"path"`
+	// Период записи снимка
+	Interval time.Duration `yaml:"interval"`
+	// Предельное время повторного чтения сообщений, пришедших после снимка
+	ReplayTimeout time.Duration `yaml:"replay_timeout"`
+}
+
+// Параметры остановки сервиса
+type ShutdownConfig struct {
+	// Общее время на завершение обработки сообщений и HTTP-запросов после сигнала остановки
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Параметры встроенного генератора тестовых заказов
+type SenderConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	ClientID string        `yaml:"client_id"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Функция получения конфигурации по умолчанию
+func defaultConfig() Config {
+	return Config{
+		NATS: NATSConfig{
+			Transport:   "stan",
+			URL:         "nats://localhost:4222",
+			ClusterID:   "test-cluster",
+			ClientID:    "your_client_id_2",
+			Subject:     "your_subject",
+			DurableName: "durable-order-sub",
+			AckWait:     30 * time.Second,
+			MaxInflight: 64,
+			Stream:      "ORDERS",
+		},
+		DB: DBConfig{
+			Host:     "localhost",
+			Port:     5433,
+			User:     "Admin_Gena",
+			Password: "pass",
+			Name:     "orders_db",
+			SSLMode:  "disable",
+
+			MinConns:               2,
+			MaxConns:               10,
+			HealthCheckPeriod:      time.Minute,
+			MaxConnLifetime:        time.Hour,
+			MaxConnIdleTime:        30 * time.Minute,
+			StatementCacheMode:     "prepare",
+			StatementCacheCapacity: 512,
+			ConnectAttempts:        5,
+			QueryTimeout:           5 * time.Second,
+		},
+		Storage: StorageConfig{
+			Driver:     "postgres",
+			SQLitePath: "orders.db",
+		},
+		HTTP: HTTPConfig{
+			Addr:               ":8080",
+			ReadHeaderTimeout:  5 * time.Second,
+			ReadTimeout:        10 * time.Second,
+			WriteTimeout:       30 * time.Second,
+			IdleTimeout:        2 * time.Minute,
+			BatchMaxUIDs:       1000,
+			BatchStreamMaxUIDs: 100000,
+		},
+		Ingest: IngestConfig{
+			DuplicatePolicy: DuplicateIgnore,
+			MaxRedeliveries: 0,
+		},
+		Restore: RestoreConfig{
+			Source:     RestoreFromDB,
+			ReplayFrom: "all",
+			BatchSize:  1000,
+			Timeout:    5 * time.Minute,
+		},
+		Cache: CacheConfig{
+			Policy:             EvictLRU,
+			MaxEntries:         100000,
+			MaxBytes:           256 << 20,
+			Shards:             32,
+			GzipMinSize:        512,
+			NegativeTTL:        30 * time.Second,
+			NegativeMaxEntries: 10000,
+		},
+		Snapshot: SnapshotConfig{
+			Path:          "orders-cache.snapshot",
+			Interval:      5 * time.Minute,
+			ReplayTimeout: time.Minute,
+		},
+		Sender: SenderConfig{
+			Enabled:  true,
+			ClientID: "cliend_id_1",
+			Interval: 10 * time.Second,
+		},
+		Shutdown: ShutdownConfig{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// Описание параметра конфигурации: имя флага, переменная окружения
+// и признак того, что параметр можно менять без перезапуска
+type configField struct {
+	flag       string
+	env        string
+	usage      string
+	reloadable bool
+	value      func(c *Config) flag.Value
+}
+
+// Таблица всех параметров, доступных через переменные окружения и флаги
+var configFields = []configField{
+	{"nats-transport", "ORDERS_NATS_TRANSPORT", "транспорт получения заказов: stan или jetstream", false, func(c *Config) flag.Value { return (*stringValue)(&c.NATS.Transport) }},
+	{"nats-url", "ORDERS_NATS_URL", "адрес NATS-сервера", false, func(c *Config) flag.Value { return (*stringValue)(&c.NATS.URL) }},
+	{"nats-cluster-id", "ORDERS_NATS_CLUSTER_ID", "идентификатор кластера NATS Streaming", false, func(c *Config) flag.Value { return (*stringValue)(&c.NATS.ClusterID) }},
+	{"nats-client-id", "ORDERS_NATS_CLIENT_ID", "идентификатор клиента NATS Streaming", false, func(c *Config) flag.Value { return (*stringValue)(&c.NATS.ClientID) }},
+	{"nats-subject", "ORDERS_NATS_SUBJECT", "канал с заказами", false, func(c *Config) flag.Value { return (*stringValue)(&c.NATS.Subject) }},
+	{"nats-durable-name", "ORDERS_NATS_DURABLE_NAME", "имя durable-подписки", false, func(c *Config) flag.Value { return (*stringValue)(&c.NATS.DurableName) }},
+	{"nats-ack-wait", "ORDERS_NATS_ACK_WAIT", "время ожидания подтверждения сообщения", false, func(c *Config) flag.Value { return (*durationValue)(&c.NATS.AckWait) }},
+	{"nats-max-inflight", "ORDERS_NATS_MAX_INFLIGHT", "максимальное количество неподтверждённых сообщений", false, func(c *Config) flag.Value { return (*intValue)(&c.NATS.MaxInflight) }},
+	{"nats-stream", "ORDERS_NATS_STREAM", "поток JetStream с заказами", false, func(c *Config) flag.Value { return (*stringValue)(&c.NATS.Stream) }},
+	{"nats-max-deliver", "ORDERS_NATS_MAX_DELIVER", "предельное количество доставок сообщения JetStream, 0 - без ограничения", false, func(c *Config) flag.Value { return (*intValue)(&c.NATS.MaxDeliver) }},
+	{"nats-backoff", "ORDERS_NATS_BACKOFF", "задержки повторных доставок JetStream через запятую, например 1s,5s,30s", false, func(c *Config) flag.Value { return (*durationListValue)(&c.NATS.BackOff) }},
+	{"db-host", "ORDERS_DB_HOST", "хост PostgreSQL", false, func(c *Config) flag.Value { return (*stringValue)(&c.DB.Host) }},
+	{"db-port", "ORDERS_DB_PORT", "порт PostgreSQL", false, func(c *Config) flag.Value { return (*intValue)(&c.DB.Port) }},
+	{"db-user", "ORDERS_DB_USER", "пользователь PostgreSQL", false, func(c *Config) flag.Value { return (*stringValue)(&c.DB.User) }},
+	{"db-password", "ORDERS_DB_PASSWORD", "пароль PostgreSQL", false, func(c *Config) flag.Value { return (*stringValue)(&c.DB.Password) }},
+	{"db-name", "ORDERS_DB_NAME", "имя базы данных", false, func(c *Config) flag.Value { return (*stringValue)(&c.DB.Name) }},
+	{"db-sslmode", "ORDERS_DB_SSLMODE", "режим SSL для PostgreSQL", false, func(c *Config) flag.Value { return (*stringValue)(&c.DB.SSLMode) }},
+	{"db-min-conns", "ORDERS_DB_MIN_CONNS", "минимальное количество соединений в пуле", false, func(c *Config) flag.Value { return (*intValue)(&c.DB.MinConns) }},
+	{"db-max-conns", "ORDERS_DB_MAX_CONNS", "максимальное количество соединений в пуле", false, func(c *Config) flag.Value { return (*intValue)(&c.DB.MaxConns) }},
+	{"db-health-check-period", "ORDERS_DB_HEALTH_CHECK_PERIOD", "период проверки простаивающих соединений", false, func(c *Config) flag.Value { return (*durationValue)(&c.DB.HealthCheckPeriod) }},
+	{"db-max-conn-lifetime", "ORDERS_DB_MAX_CONN_LIFETIME", "максимальное время жизни соединения", false, func(c *Config) flag.Value { return (*durationValue)(&c.DB.MaxConnLifetime) }},
+	{"db-max-conn-idle-time", "ORDERS_DB_MAX_CONN_IDLE_TIME", "время простоя, после которого соединение закрывается", false, func(c *Config) flag.Value { return (*durationValue)(&c.DB.MaxConnIdleTime) }},
+	{"db-statement-cache-mode", "ORDERS_DB_STATEMENT_CACHE_MODE", "режим кеша выражений: prepare или describe", false, func(c *Config) flag.Value { return (*stringValue)(&c.DB.StatementCacheMode) }},
+	{"db-statement-cache-capacity", "ORDERS_DB_STATEMENT_CACHE_CAPACITY", "размер кеша выражений на соединение, 0 отключает кеш", false, func(c *Config) flag.Value { return (*intValue)(&c.DB.StatementCacheCapacity) }},
+	{"db-connect-attempts", "ORDERS_DB_CONNECT_ATTEMPTS", "количество попыток подключения к PostgreSQL при запуске", false, func(c *Config) flag.Value { return (*intValue)(&c.DB.ConnectAttempts) }},
+	{"db-auto-migrate", "ORDERS_DB_AUTO_MIGRATE", "применять недостающие миграции схемы при запуске", false, func(c *Config) flag.Value { return (*boolValue)(&c.DB.AutoMigrate) }},
+	{"db-query-timeout", "ORDERS_DB_QUERY_TIMEOUT", "предельное время одной операции с хранилищем", true, func(c *Config) flag.Value { return (*durationValue)(&c.DB.QueryTimeout) }},
+	{"storage-driver", "ORDERS_STORAGE_DRIVER", "тип хранилища: postgres, sqlite или memory", false, func(c *Config) flag.Value { return (*stringValue)(&c.Storage.Driver) }},
+	{"storage-sqlite-path", "ORDERS_STORAGE_SQLITE_PATH", "путь к файлу SQLite", false, func(c *Config) flag.Value { return (*stringValue)(&c.Storage.SQLitePath) }},
+	{"http-addr", "ORDERS_HTTP_ADDR", "адрес HTTP-сервера", false, func(c *Config) flag.Value { return (*stringValue)(&c.HTTP.Addr) }},
+	{"http-read-header-timeout", "ORDERS_HTTP_READ_HEADER_TIMEOUT", "время на чтение заголовков запроса", false, func(c *Config) flag.Value { return (*durationValue)(&c.HTTP.ReadHeaderTimeout) }},
+	{"http-read-timeout", "ORDERS_HTTP_READ_TIMEOUT", "время на чтение всего запроса", false, func(c *Config) flag.Value { return (*durationValue)(&c.HTTP.ReadTimeout) }},
+	{"http-write-timeout", "ORDERS_HTTP_WRITE_TIMEOUT", "время на запись ответа", false, func(c *Config) flag.Value { return (*durationValue)(&c.HTTP.WriteTimeout) }},
+	{"http-idle-timeout", "ORDERS_HTTP_IDLE_TIMEOUT", "время простоя keep-alive соединения", false, func(c *Config) flag.Value { return (*durationValue)(&c.HTTP.IdleTimeout) }},
+	{"http-batch-max-uids", "ORDERS_HTTP_BATCH_MAX_UIDS", "предельное количество order_uid в пакетном запросе с ответом JSON", true, func(c *Config) flag.Value { return (*intValue)(&c.HTTP.BatchMaxUIDs) }},
+	{"http-batch-stream-max-uids", "ORDERS_HTTP_BATCH_STREAM_MAX_UIDS", "предельное количество order_uid в пакетном запросе с ответом NDJSON", true, func(c *Config) flag.Value { return (*intValue)(&c.HTTP.BatchStreamMaxUIDs) }},
+	{"ingest-duplicate-policy", "ORDERS_INGEST_DUPLICATE_POLICY", "обработка повторного order_uid: ignore, replace или reject-if-different", true, func(c *Config) flag.Value { return (*stringValue)(&c.Ingest.DuplicatePolicy) }},
+	{"ingest-max-redeliveries", "ORDERS_INGEST_MAX_REDELIVERIES", "количество попыток обработки сообщения, 0 - без ограничения", true, func(c *Config) flag.Value { return (*intValue)(&c.Ingest.MaxRedeliveries) }},
+	{"restore-source", "ORDERS_RESTORE_SOURCE", "источник восстановления кеша: db или replay", false, func(c *Config) flag.Value { return (*stringValue)(&c.Restore.Source) }},
+	{"restore-replay-from", "ORDERS_RESTORE_REPLAY_FROM", "позиция начала чтения канала: all, номер сообщения, время RFC3339 или длительность", false, func(c *Config) flag.Value { return (*stringValue)(&c.Restore.ReplayFrom) }},
+	{"restore-batch-size", "ORDERS_RESTORE_BATCH_SIZE", "размер пачки при восстановлении кеша", true, func(c *Config) flag.Value { return (*intValue)(&c.Restore.BatchSize) }},
+	{"restore-timeout", "ORDERS_RESTORE_TIMEOUT", "предельное время восстановления кеша при запуске", true, func(c *Config) flag.Value { return (*durationValue)(&c.Restore.Timeout) }},
+	{"cache-policy", "ORDERS_CACHE_POLICY", "политика вытеснения из кеша: lru, lfu или ttl", false, func(c *Config) flag.Value { return (*stringValue)(&c.Cache.Policy) }},
+	{"cache-max-entries", "ORDERS_CACHE_MAX_ENTRIES", "максимальное количество заказов в кеше, 0 - без ограничения", false, func(c *Config) flag.Value { return (*intValue)(&c.Cache.MaxEntries) }},
+	{"cache-max-bytes", "ORDERS_CACHE_MAX_BYTES", "приблизительный предельный объём кеша в байтах, 0 - без ограничения", false, func(c *Config) flag.Value { return (*int64Value)(&c.Cache.MaxBytes) }},
+	{"cache-ttl", "ORDERS_CACHE_TTL", "время хранения заказа в кеше, 0 - без ограничения", false, func(c *Config) flag.Value { return (*durationValue)(&c.Cache.TTL) }},
+	{"cache-shards", "ORDERS_CACHE_SHARDS", "количество сегментов кеша", false, func(c *Config) flag.Value { return (*intValue)(&c.Cache.Shards) }},
+	{"cache-gzip-min-size", "ORDERS_CACHE_GZIP_MIN_SIZE", "минимальная длина ответа для хранения сжатого представления, -1 отключает сжатие", false, func(c *Config) flag.Value { return (*intValue)(&c.Cache.GzipMinSize) }},
+	{"cache-negative-ttl", "ORDERS_CACHE_NEGATIVE_TTL", "время хранения отсутствующих order_uid, 0 отключает", true, func(c *Config) flag.Value { return (*durationValue)(&c.Cache.NegativeTTL) }},
+	{"cache-negative-max-entries", "ORDERS_CACHE_NEGATIVE_MAX_ENTRIES", "максимальное количество запомненных отсутствующих order_uid", true, func(c *Config) flag.Value { return (*intValue)(&c.Cache.NegativeMaxEntries) }},
+	{"snapshot-path", "ORDERS_SNAPSHOT_PATH", "путь к файлу снимка кеша, пустая строка отключает снимки", false, func(c *Config) flag.Value { return (*stringValue)(&c.Snapshot.Path) }},
+	{"snapshot-interval", "ORDERS_SNAPSHOT_INTERVAL", "период записи снимка кеша", true, func(c *Config) flag.Value { return (*durationValue)(&c.Snapshot.Interval) }},
+	{"snapshot-replay-timeout", "ORDERS_SNAPSHOT_REPLAY_TIMEOUT", "предельное время чтения сообщений, пришедших после снимка", false, func(c *Config) flag.Value { return (*durationValue)(&c.Snapshot.ReplayTimeout) }},
+	{"sender-enabled", "ORDERS_SENDER_ENABLED", "включить генератор тестовых заказов", true, func(c *Config) flag.Value { return (*boolValue)(&c.Sender.Enabled) }},
+	{"sender-client-id", "ORDERS_SENDER_CLIENT_ID", "идентификатор клиента NATS Streaming для генератора", false, func(c *Config) flag.Value { return (*stringValue)(&c.Sender.ClientID) }},
+	{"sender-interval", "ORDERS_SENDER_INTERVAL", "интервал отправки тестовых заказов", true, func(c *Config) flag.Value { return (*durationValue)(&c.Sender.Interval) }},
+	{"shutdown-timeout", "ORDERS_SHUTDOWN_TIMEOUT", "время на завершение обработки при остановке сервиса", true, func(c *Config) flag.Value { return (*durationValue)(&c.Shutdown.Timeout) }},
+}
+
+// Текущая конфигурация приложения
+var appConfig atomic.Pointer[Config]
+
+// Функция получения текущей конфигурации
+func currentConfig() *Config {
+	if cfg := appConfig.Load(); cfg != nil {
+		return cfg
+	}
+	cfg := defaultConfig()
+	return &cfg
+}
+
+// Функция загрузки конфигурации из файла, переменных окружения и аргументов командной строки.
+// Возвращает также позиционные аргументы, оставшиеся после флагов.
+func loadConfig(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("orders", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("ORDERS_CONFIG"), "путь к YAML-файлу конфигурации")
+	var scratch Config
+	for _, field := range configFields {
+		fs.Var(field.value(&scratch), field.flag, field.usage+" ("+field.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := defaultConfig()
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка чтения файла конфигурации: %w", err)
+		}
+		// Неизвестные ключи считаются ошибкой, чтобы опечатка в имени настройки не терялась молча
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("ошибка разбора файла конфигурации %s: %w", *configPath, err)
+		}
+	}
+
+	for _, field := range configFields {
+		raw, ok := os.LookupEnv(field.env)
+		if !ok {
+			continue
+		}
+		if err := field.value(&cfg).Set(raw); err != nil {
+			return nil, nil, fmt.Errorf("некорректное значение %s=%q: %w", field.env, raw, err)
+		}
+	}
+
+	// Флаги применяются последними и только если были явно указаны
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, field := range configFields {
+			if field.flag == f.Name && flagErr == nil {
+				flagErr = field.value(&cfg).Set(f.Value.String())
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return &cfg, fs.Args(), nil
+}
+
+// Функция проверки корректности конфигурации
+func (c *Config) Validate() error {
+	var errs []error
+	required := []struct{ name, value string }{
+		{"nats.url", c.NATS.URL},
+		{"nats.client_id", c.NATS.ClientID},
+		{"nats.subject", c.NATS.Subject},
+		{"nats.durable_name", c.NATS.DurableName},
+		{"db.host", c.DB.Host},
+		{"db.user", c.DB.User},
+		{"db.name", c.DB.Name},
+		{"sender.client_id", c.Sender.ClientID},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			errs = append(errs, fmt.Errorf("параметр %s не задан", field.name))
+		}
+	}
+	switch c.Storage.Driver {
+	case "postgres", "memory":
+	case "sqlite":
+		if c.Storage.SQLitePath == "" {
+			errs = append(errs, errors.New("параметр storage.sqlite_path не задан"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("неизвестный storage.driver %q, допустимы postgres, sqlite, memory", c.Storage.Driver))
+	}
+	switch c.NATS.Transport {
+	case "stan":
+		if c.NATS.ClusterID == "" {
+			errs = append(errs, errors.New("параметр nats.cluster_id не задан"))
+		}
+	case "jetstream":
+		if c.NATS.Stream == "" {
+			errs = append(errs, errors.New("параметр nats.stream не задан"))
+		}
+		if c.NATS.MaxDeliver < 0 {
+			errs = append(errs, fmt.Errorf("nats.max_deliver не может быть отрицательным, получено %d", c.NATS.MaxDeliver))
+		}
+		// Сервер JetStream требует, чтобы задержек было меньше, чем доставок
+		if c.NATS.MaxDeliver > 0 && len(c.NATS.BackOff) >= c.NATS.MaxDeliver {
+			errs = append(errs, fmt.Errorf("nats.backoff должен содержать меньше значений, чем nats.max_deliver (%d)", c.NATS.MaxDeliver))
+		}
+		for _, d := range c.NATS.BackOff {
+			if d <= 0 {
+				errs = append(errs, fmt.Errorf("значения nats.backoff должны быть положительными, получено %s", d))
+				break
+			}
+		}
+	default:
+		errs = append(errs, fmt.Errorf("неизвестный nats.transport %q, допустимы stan, jetstream", c.NATS.Transport))
+	}
+	if c.NATS.AckWait < time.Second {
+		errs = append(errs, fmt.Errorf("nats.ack_wait должен быть не меньше 1s, получено %s", c.NATS.AckWait))
+	}
+	if c.NATS.MaxInflight < 1 {
+		errs = append(errs, fmt.Errorf("nats.max_inflight должен быть положительным, получено %d", c.NATS.MaxInflight))
+	}
+	if c.Ingest.MaxRedeliveries < 0 {
+		errs = append(errs, fmt.Errorf("ingest.max_redeliveries не может быть отрицательным, получено %d", c.Ingest.MaxRedeliveries))
+	}
+	if c.DB.Port < 1 || c.DB.Port > 65535 {
+		errs = append(errs, fmt.Errorf("db.port должен быть в диапазоне 1-65535, получено %d", c.DB.Port))
+	}
+	if c.DB.MaxConns < 1 {
+		errs = append(errs, fmt.Errorf("db.max_conns должен быть положительным, получено %d", c.DB.MaxConns))
+	}
+	if c.DB.MinConns < 0 || c.DB.MinConns > c.DB.MaxConns {
+		errs = append(errs, fmt.Errorf("db.min_conns должен быть в диапазоне 0-%d, получено %d", c.DB.MaxConns, c.DB.MinConns))
+	}
+	if c.DB.HealthCheckPeriod <= 0 {
+		errs = append(errs, fmt.Errorf("db.health_check_period должен быть положительным, получено %s", c.DB.HealthCheckPeriod))
+	}
+	if c.DB.StatementCacheMode != "prepare" && c.DB.StatementCacheMode != "describe" {
+		errs = append(errs, fmt.Errorf("db.statement_cache_mode должен быть prepare или describe, получено %q", c.DB.StatementCacheMode))
+	}
+	if c.DB.StatementCacheCapacity < 0 {
+		errs = append(errs, fmt.Errorf("db.statement_cache_capacity не может быть отрицательным, получено %d", c.DB.StatementCacheCapacity))
+	}
+	if c.DB.ConnectAttempts < 1 {
+		errs = append(errs, fmt.Errorf("db.connect_attempts должен быть положительным, получено %d", c.DB.ConnectAttempts))
+	}
+	if c.DB.QueryTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("db.query_timeout должен быть положительным, получено %s", c.DB.QueryTimeout))
+	}
+	if _, _, err := net.SplitHostPort(c.HTTP.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("некорректный http.addr %q: %w", c.HTTP.Addr, err))
+	}
+	if c.HTTP.BatchMaxUIDs < 1 || c.HTTP.BatchStreamMaxUIDs < 1 {
+		errs = append(errs, fmt.Errorf("http.batch_max_uids и http.batch_stream_max_uids должны быть положительными, получено %d и %d",
+			c.HTTP.BatchMaxUIDs, c.HTTP.BatchStreamMaxUIDs))
+	}
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"http.read_header_timeout", c.HTTP.ReadHeaderTimeout},
+		{"http.read_timeout", c.HTTP.ReadTimeout},
+		{"http.write_timeout", c.HTTP.WriteTimeout},
+		{"http.idle_timeout", c.HTTP.IdleTimeout},
+		{"restore.timeout", c.Restore.Timeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s должен быть положительным, получено %s", timeout.name, timeout.value))
+		}
+	}
+	switch c.Ingest.DuplicatePolicy {
+	case DuplicateIgnore, DuplicateReplace, DuplicateRejectIfDifferent:
+	default:
+		errs = append(errs, fmt.Errorf("ingest.duplicate_policy должен быть ignore, replace или reject-if-different, получено %q", c.Ingest.DuplicatePolicy))
+	}
+	switch c.Restore.Source {
+	case RestoreFromDB:
+	case RestoreFromReplay:
+		if _, err := parseReplayPosition(c.Restore.ReplayFrom); err != nil {
+			errs = append(errs, fmt.Errorf("некорректная restore.replay_from: %w", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("неизвестный restore.source %q, допустимы db, replay", c.Restore.Source))
+	}
+	if c.Restore.BatchSize <= 0 {
+		errs = append(errs, fmt.Errorf("restore.batch_size должен быть положительным, получено %d", c.Restore.BatchSize))
+	}
+	switch c.Cache.Policy {
+	case EvictLRU, EvictLFU:
+	case EvictTTL:
+		if c.Cache.TTL <= 0 {
+			errs = append(errs, errors.New("для cache.policy ttl параметр cache.ttl должен быть положительным"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("неизвестная cache.policy %q, допустимы lru, lfu, ttl", c.Cache.Policy))
+	}
+	if c.Cache.MaxEntries < 0 || c.Cache.MaxBytes < 0 || c.Cache.TTL < 0 {
+		errs = append(errs, errors.New("cache.max_entries, cache.max_bytes и cache.ttl не могут быть отрицательными"))
+	}
+	if c.Cache.Shards < 1 || c.Cache.Shards > 1024 {
+		errs = append(errs, fmt.Errorf("cache.shards должен быть в диапазоне 1-1024, получено %d", c.Cache.Shards))
+	}
+	if c.Cache.NegativeTTL < 0 {
+		errs = append(errs, fmt.Errorf("cache.negative_ttl не может быть отрицательным, получено %s", c.Cache.NegativeTTL))
+	}
+	if c.Cache.NegativeMaxEntries < 1 {
+		errs = append(errs, fmt.Errorf("cache.negative_max_entries должен быть положительным, получено %d", c.Cache.NegativeMaxEntries))
+	}
+	if c.Snapshot.Interval <= 0 || c.Snapshot.ReplayTimeout <= 0 {
+		errs = append(errs, errors.New("snapshot.interval и snapshot.replay_timeout должны быть положительными"))
+	}
+	if c.Sender.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("sender.interval должен быть положительным, получено %s", c.Sender.Interval))
+	}
+	if c.Shutdown.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown.timeout должен быть положительным, получено %s", c.Shutdown.Timeout))
+	}
+	if c.Sender.ClientID == c.NATS.ClientID {
+		errs = append(errs, errors.New("sender.client_id должен отличаться от nats.client_id"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("некорректная конфигурация: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Функция применения новой конфигурации без перезапуска.
+// Из новой конфигурации переносятся только параметры, допускающие горячую перезагрузку,
+// об изменении остальных параметров выводится предупреждение. При ошибке применения
+// возвращается ошибка, и действующая конфигурация остаётся прежней.
+func reloadConfig(old, fresh *Config) (*Config, error) {
+	next := *old
+	for _, field := range configFields {
+		oldValue := field.value(old).String()
+		freshValue := field.value(fresh).String()
+		if oldValue == freshValue {
+			continue
+		}
+		if !field.reloadable {
+			log.Printf("Параметр %s изменён, но вступит в силу только после перезапуска", field.flag)
+			continue
+		}
+		if err := field.value(&next).Set(freshValue); err != nil {
+			return old, fmt.Errorf("параметр %s: %w", field.flag, err)
+		}
+		log.Printf("Параметр %s изменён: %s -> %s", field.flag, oldValue, freshValue)
+	}
+	if err := next.Validate(); err != nil {
+		return old, err
+	}
+	return &next, nil
+}
+
+// Функция ожидания сигнала SIGHUP и перезагрузки конфигурации
+func watchConfigReload(args []string) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+
+	for range hupCh {
+		fresh, _, err := loadConfig(args)
+		if err != nil {
+			log.Printf("Ошибка перезагрузки конфигурации, продолжаем со старой: %v", err)
+			continue
+		}
+		next, err := reloadConfig(currentConfig(), fresh)
+		if err != nil {
+			log.Printf("Ошибка применения новой конфигурации, продолжаем со старой: %v", err)
+			continue
+		}
+		appConfig.Store(next)
+		log.Println("Конфигурация перезагружена")
+	}
+}
+
+// Функция получения строки подключения к PostgreSQL в виде URL,
+// чтобы пароль и имя пользователя с пробелами и спецсимволами экранировались
+func (c DBConfig) ConnString() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		Path:     "/" + c.Name,
+		RawQuery: url.Values{"sslmode": {c.SSLMode}}.Encode(),
+	}
+	return u.String()
+}
+
+// Адаптеры полей конфигурации к интерфейсу flag.Value
+
+type stringValue string
+
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+func (v *stringValue) String() string     { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*v = intValue(n)
+	return nil
+}
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type int64Value int64
+
+func (v *int64Value) Set(s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*v = int64Value(n)
+	return nil
+}
+func (v *int64Value) String() string { return strconv.FormatInt(int64(*v), 10) }
+
+type boolValue bool
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(b)
+	return nil
+}
+func (v *boolValue) String() string   { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*v = durationValue(d)
+	return nil
+}
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+type durationListValue []time.Duration
+
+func (v *durationListValue) Set(s string) error {
+	var list []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return err
+		}
+		list = append(list, d)
+	}
+	*v = list
+	return nil
+}
+func (v *durationListValue) String() string {
+	parts := make([]string, len(*v))
+	for i, d := range *v {
+		parts[i] = d.String()
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	// Файл задаёт порт базы, адрес HTTP-сервера и интервал генератора
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "db:\n  port: 6000\nhttp:\n  addr: \":9000\"\nsender:\n  interval: 30s\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("Не удалось записать файл конфигурации: %v", err)
+	}
+
+	// Переменная окружения переопределяет файл, флаг переопределяет переменную окружения
+	t.Setenv("ORDERS_DB_PORT", "6001")
+	t.Setenv("ORDERS_HTTP_ADDR", ":9001")
+
+	cfg, _, err := loadConfig([]string{"-config", path, "-http-addr", ":9002"})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+
+	if cfg.Sender.Interval != 30*time.Second {
+		t.Errorf("Ожидался интервал из файла 30s, получено: %s", cfg.Sender.Interval)
+	}
+	if cfg.DB.Port != 6001 {
+		t.Errorf("Ожидался порт из окружения 6001, получено: %d", cfg.DB.Port)
+	}
+	if cfg.HTTP.Addr != ":9002" {
+		t.Errorf("Ожидался адрес из флага :9002, получено: %s", cfg.HTTP.Addr)
+	}
+	if cfg.DB.Name != defaultConfig().DB.Name {
+		t.Errorf("Ожидалось имя базы по умолчанию %s, получено: %s", defaultConfig().DB.Name, cfg.DB.Name)
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	t.Setenv("ORDERS_DB_PORT", "70000")
+
+	if _, _, err := loadConfig(nil); err == nil {
+		t.Error("Ожидалась ошибка валидации для порта 70000")
+	}
+}
+
+func TestLoadConfig_UnknownField(t *testing.T) {
+	// Опечатка в имени настройки не должна молча игнорироваться
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("db:\n  prot: 6000\n"), 0o600); err != nil {
+		t.Fatalf("Не удалось записать файл конфигурации: %v", err)
+	}
+
+	if _, _, err := loadConfig([]string{"-config", path}); err == nil {
+		t.Error("Ожидалась ошибка для неизвестного поля db.prot")
+	}
+}
+
+func TestDBConfig_ConnStringEscapesPassword(t *testing.T) {
+	cfg := defaultConfig().DB
+	cfg.User = "user name"
+	cfg.Password = "p@ss word='x'/?#"
+
+	parsed, err := pgxpool.ParseConfig(cfg.ConnString())
+	if err != nil {
+		t.Fatalf("Ошибка разбора строки подключения: %v", err)
+	}
+	if parsed.ConnConfig.User != cfg.User || parsed.ConnConfig.Password != cfg.Password {
+		t.Errorf("Ожидались пользователь %q и пароль %q, получено: %q и %q",
+			cfg.User, cfg.Password, parsed.ConnConfig.User, parsed.ConnConfig.Password)
+	}
+	if parsed.ConnConfig.Database != cfg.Name || parsed.ConnConfig.Port != uint16(cfg.Port) {
+		t.Errorf("Ожидались база %s и порт %d, получено: %s и %d",
+			cfg.Name, cfg.Port, parsed.ConnConfig.Database, parsed.ConnConfig.Port)
+	}
+}
+
+func TestLoadConfig_JetStream(t *testing.T) {
+	t.Setenv("ORDERS_NATS_TRANSPORT", "jetstream")
+	t.Setenv("ORDERS_NATS_BACKOFF", "1s, 5s,30s")
+
+	cfg, _, err := loadConfig([]string{"-nats-max-deliver", "5"})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки конфигурации: %v", err)
+	}
+	want := []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+	if len(cfg.NATS.BackOff) != len(want) || cfg.NATS.BackOff[2] != want[2] {
+		t.Errorf("Ожидались задержки %v, получено: %v", want, cfg.NATS.BackOff)
+	}
+
+	// Задержек должно быть меньше, чем доставок
+	if _, _, err := loadConfig([]string{"-nats-max-deliver", "3"}); err == nil {
+		t.Error("Ожидалась ошибка валидации для nats.max_deliver меньше количества задержек")
+	}
+}
+
+func TestReloadConfig_OnlyReloadable(t *testing.T) {
+	old := defaultConfig()
+	fresh := defaultConfig()
+	fresh.DB.Port = 6000
+	fresh.Sender.Interval = time.Minute
+
+	next, err := reloadConfig(&old, &fresh)
+	if err != nil {
+		t.Fatalf("Ошибка применения конфигурации: %v", err)
+	}
+
+	if next.DB.Port != old.DB.Port {
+		t.Errorf("Порт базы не должен меняться без перезапуска, получено: %d", next.DB.Port)
+	}
+	if next.Sender.Interval != time.Minute {
+		t.Errorf("Ожидался новый интервал генератора 1m, получено: %s", next.Sender.Interval)
+	}
+}
+
+func TestReloadConfig_InvalidKeepsOld(t *testing.T) {
+	old := defaultConfig()
+	fresh := defaultConfig()
+	fresh.Sender.Enabled = !old.Sender.Enabled
+	fresh.Sender.Interval = -time.Second
+
+	next, err := reloadConfig(&old, &fresh)
+	if err == nil {
+		t.Fatal("Ожидалась ошибка для отрицательного интервала генератора")
+	}
+	if next != &old {
+		t.Error("При ошибке должна остаться прежняя конфигурация")
+	}
+	if old.Sender.Enabled == fresh.Sender.Enabled || old.Sender.Interval == fresh.Sender.Interval {
+		t.Error("Прежняя конфигурация не должна изменяться")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Сообщение с заказом, полученное из брокера, независимо от транспорта
+type consumerMessage struct {
+	Subject      string
+	Sequence     uint64 // Номер сообщения в канале NATS Streaming или в потоке JetStream
+	Data         []byte
+	Redelivered  bool
+	Redeliveries uint32 // Количество повторных доставок по данным сервера
+
+	ack func() error
+}
+
+// Функция подтверждения обработки сообщения
+func (m *consumerMessage) Ack() error {
+	if m.ack == nil {
+		return nil
+	}
+	return m.ack()
+}
+
+// Получатель сообщений с заказами.
+// Сообщение, для которого не вызван Ack, сервер доставит повторно после nats.ack_wait.
+type OrderConsumer interface {
+	// Подписка на канал с заказами, handler вызывается последовательно для каждого сообщения
+	Subscribe(handler func(msg *consumerMessage)) error
+	// Повторное чтение сообщений канала начиная с позиции from до последнего сообщения
+	// на момент вызова временной подпиской, без подтверждений и без влияния на durable-подписку.
+	// Используется для прогрева кеша после загрузки снимка и для восстановления кеша из канала.
+	Replay(ctx context.Context, from replayPosition, handler func(msg *consumerMessage)) error
+	// Номер последнего сообщения канала на момент вызова, 0 если канал пуст
+	LastSequence(ctx context.Context) (uint64, error)
+	// Остановка получения сообщений и закрытие соединения.
+	// Durable-подписка при этом сохраняется, и после перезапуска получение продолжится с того же места.
+	Close() error
+}
+
+// Позиция начала повторного чтения канала: номер сообщения, момент времени
+// или, если оба значения нулевые, самое раннее доступное сообщение
+type replayPosition struct {
+	Sequence uint64
+	Time     time.Time
+}
+
+// Функция проверки, что после позиции from в канале нет сообщений. last и lastTime - номер
+// и время последнего сообщения канала; без этой проверки повторное чтение с позиции за последним
+// сообщением ждало бы нового сообщения до истечения времени ожидания.
+func replayRangeEmpty(from replayPosition, last uint64, lastTime time.Time) bool {
+	if last == 0 || last < from.Sequence {
+		return true
+	}
+	return !from.Time.IsZero() && lastTime.Before(from.Time)
+}
+
+// Функция разбора позиции начала повторного чтения: "all", номер сообщения,
+// момент времени в RFC3339 или длительность, отсчитываемая назад от текущего момента (например 24h)
+func parseReplayPosition(value string) (replayPosition, error) {
+	if value == "" || value == "all" {
+		return replayPosition{}, nil
+	}
+	if seq, err := strconv.ParseUint(value, 10, 64); err == nil {
+		if seq == 0 {
+			return replayPosition{}, errors.New("номер сообщения начинается с 1")
+		}
+		return replayPosition{Sequence: seq}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return replayPosition{Time: t}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return replayPosition{Time: time.Now().Add(-d)}, nil
+	}
+	return replayPosition{}, fmt.Errorf("ожидается all, номер сообщения, время в RFC3339 или длительность, получено %q", value)
+}
+
+// Отправитель сообщений с заказами
+type orderPublisher interface {
+	Publish(subject string, data []byte) error
+	Close() error
+}
+
+// Функция создания получателя сообщений для транспорта, выбранного в nats.transport
+func newOrderConsumer(cfg NATSConfig) (OrderConsumer, error) {
+	switch cfg.Transport {
+	case "stan":
+		return newSTANConsumer(cfg)
+	case "jetstream":
+		return newJetStreamConsumer(cfg)
+	default:
+		return nil, fmt.Errorf("неизвестный транспорт %q", cfg.Transport)
+	}
+}
+
+// Функция создания отправителя сообщений для транспорта, выбранного в nats.transport.
+// clientID используется как идентификатор клиента NATS Streaming и как имя соединения NATS.
+func newOrderPublisher(cfg NATSConfig, clientID string) (orderPublisher, error) {
+	switch cfg.Transport {
+	case "stan":
+		return newSTANPublisher(cfg, clientID)
+	case "jetstream":
+		return newJetStreamPublisher(cfg, clientID)
+	default:
+		return nil, fmt.Errorf("неизвестный транспорт %q", cfg.Transport)
+	}
+}
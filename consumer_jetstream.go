@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Максимальное время ожидания одной пачки сообщений из pull-подписки
+const jetStreamFetchWait = 5 * time.Second
+
+// Получатель заказов из durable pull-подписки JetStream
+type jetStreamConsumer struct {
+	cfg NATSConfig
+	nc  *nats.Conn
+	js  nats.JetStreamContext
+
+	cancel context.CancelFunc
+}
+
+// Функция подключения к JetStream.
+// Поток nats.stream создаётся, если его ещё нет, чтобы отправители могли переходить на JetStream по одному.
+func newJetStreamConsumer(cfg NATSConfig) (*jetStreamConsumer, error) {
+	nc, js, err := connectJetStream(cfg, cfg.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	return &jetStreamConsumer{cfg: cfg, nc: nc, js: js}, nil
+}
+
+// Подписка создаёт durable-получателя с явным подтверждением. Неподтверждённое сообщение
+// доставляется повторно через ack_wait или через задержки nats.backoff, но не больше nats.max_deliver раз.
+func (c *jetStreamConsumer) Subscribe(handler func(msg *consumerMessage)) error {
+	opts := []nats.SubOpt{
+		nats.BindStream(c.cfg.Stream),
+		nats.AckExplicit(),
+		nats.AckWait(c.cfg.AckWait),
+		nats.MaxAckPending(c.cfg.MaxInflight),
+	}
+	if c.cfg.MaxDeliver > 0 {
+		opts = append(opts, nats.MaxDeliver(c.cfg.MaxDeliver))
+	}
+	if len(c.cfg.BackOff) > 0 {
+		opts = append(opts, nats.BackOff(c.cfg.BackOff))
+	}
+
+	sub, err := c.js.PullSubscribe(c.cfg.Subject, c.cfg.DurableName, opts...)
+	if err != nil {
+		return fmt.Errorf("ошибка установки подписки на JetStream: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go c.fetchLoop(ctx, sub, handler)
+	return nil
+}
+
+// Цикл получения пачек сообщений из pull-подписки до остановки получателя
+func (c *jetStreamConsumer) fetchLoop(ctx context.Context, sub *nats.Subscription, handler func(msg *consumerMessage)) {
+	for ctx.Err() == nil {
+		fetchCtx, cancel := context.WithTimeout(ctx, jetStreamFetchWait)
+		msgs, err := sub.Fetch(c.cfg.MaxInflight, nats.Context(fetchCtx))
+		cancel()
+		if err != nil {
+			// Отсутствие новых сообщений за время ожидания не является ошибкой
+			if ctx.Err() == nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, nats.ErrTimeout) {
+				log.Printf("Ошибка получения сообщений из JetStream: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			meta, err := msg.Metadata()
+			if err != nil {
+				log.Printf("Получено сообщение JetStream без метаданных: %v", err)
+				continue
+			}
+			handler(&consumerMessage{
+				Subject:      msg.Subject,
+				Sequence:     meta.Sequence.Stream,
+				Data:         msg.Data,
+				Redelivered:  meta.NumDelivered > 1,
+				Redeliveries: uint32(meta.NumDelivered - 1),
+				ack:          func() error { return msg.Ack() },
+			})
+		}
+	}
+}
+
+// Повторное чтение выполняется временным получателем без подтверждений, пока у него
+// не останется ожидающих сообщений темы. Счётчик ожидающих сообщений сервер считает
+// с учётом фильтра темы, поэтому пропуски последовательностей, удалённые сообщения
+// и сообщения других тем потока не задерживают завершение.
+func (c *jetStreamConsumer) Replay(ctx context.Context, from replayPosition, handler func(msg *consumerMessage)) error {
+	info, err := c.js.StreamInfo(c.cfg.Stream)
+	if err != nil {
+		return fmt.Errorf("ошибка получения состояния потока %s: %w", c.cfg.Stream, err)
+	}
+	if replayRangeEmpty(from, info.State.LastSeq, info.State.LastTime) {
+		return nil
+	}
+
+	start := nats.DeliverAll()
+	switch {
+	case from.Sequence > 0:
+		start = nats.StartSequence(from.Sequence)
+	case !from.Time.IsZero():
+		start = nats.StartTime(from.Time)
+	}
+	sub, err := c.js.SubscribeSync(c.cfg.Subject, nats.BindStream(c.cfg.Stream), start, nats.AckNone())
+	if err != nil {
+		return fmt.Errorf("ошибка подписки для повторного чтения потока: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	// Если в диапазоне нет ни одного сообщения темы, ждать первого сообщения нельзя
+	consumer, err := sub.ConsumerInfo()
+	if err != nil {
+		return fmt.Errorf("ошибка получения состояния получателя повторного чтения: %w", err)
+	}
+	if consumer.NumPending == 0 && consumer.Delivered.Consumer == 0 {
+		return nil
+	}
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return err
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			return fmt.Errorf("получено сообщение JetStream без метаданных: %w", err)
+		}
+		handler(&consumerMessage{Subject: msg.Subject, Sequence: meta.Sequence.Stream, Data: msg.Data})
+		if meta.NumPending == 0 {
+			return nil
+		}
+	}
+}
+
+func (c *jetStreamConsumer) LastSequence(ctx context.Context) (uint64, error) {
+	info, err := c.js.StreamInfo(c.cfg.Stream, nats.Context(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения состояния потока %s: %w", c.cfg.Stream, err)
+	}
+	return info.State.LastSeq, nil
+}
+
+// Остановка цикла получения и закрытие соединения. Подтверждения сообщений, обработка
+// которых ещё не завершилась, после закрытия не отправятся, и сервер доставит их повторно.
+// Подписка не отменяется через Unsubscribe, потому что он удаляет durable-получателя на сервере.
+func (c *jetStreamConsumer) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.nc.Close()
+	return nil
+}
+
+// Отправитель заказов в поток JetStream
+type jetStreamPublisher struct {
+	nc *nats.Conn
+	js nats.JetStreamContext
+}
+
+// Функция подключения отправителя к JetStream
+func newJetStreamPublisher(cfg NATSConfig, name string) (*jetStreamPublisher, error) {
+	nc, js, err := connectJetStream(cfg, name)
+	if err != nil {
+		return nil, err
+	}
+	return &jetStreamPublisher{nc: nc, js: js}, nil
+}
+
+// Публикация ожидает подтверждения от сервера, что сообщение сохранено в потоке
+func (p *jetStreamPublisher) Publish(subject string, data []byte) error {
+	_, err := p.js.Publish(subject, data)
+	return err
+}
+
+func (p *jetStreamPublisher) Close() error {
+	p.nc.Close()
+	return nil
+}
+
+// Функция подключения к NATS и проверки наличия потока с заказами
+func connectJetStream(cfg NATSConfig, name string) (*nats.Conn, nats.JetStreamContext, error) {
+	nc, err := nats.Connect(cfg.URL, nats.Name(name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка подключения к NATS: %w", err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("ошибка получения контекста JetStream: %w", err)
+	}
+
+	_, err = js.StreamInfo(cfg.Stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     cfg.Stream,
+			Subjects: []string{cfg.Subject},
+			Storage:  nats.FileStorage,
+		})
+		if err == nil {
+			log.Printf("Создан поток JetStream %s для канала %s", cfg.Stream, cfg.Subject)
+		}
+	}
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("ошибка проверки потока JetStream %s: %w", cfg.Stream, err)
+	}
+	return nc, js, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+// Получатель заказов из NATS Streaming
+type stanConsumer struct {
+	cfg NATSConfig
+	sc  stan.Conn
+}
+
+// Функция подключения к NATS Streaming
+func newSTANConsumer(cfg NATSConfig) (*stanConsumer, error) {
+	sc, err := stan.Connect(cfg.ClusterID, cfg.ClientID, stan.NatsURL(cfg.URL))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к NATS Streaming: %w", err)
+	}
+	return &stanConsumer{cfg: cfg, sc: sc}, nil
+}
+
+// Подписка работает в режиме ручного подтверждения: сообщение подтверждается только после
+// фиксации заказа в хранилище, иначе NATS Streaming доставит его повторно через ack_wait.
+func (c *stanConsumer) Subscribe(handler func(msg *consumerMessage)) error {
+	_, err := c.sc.Subscribe(c.cfg.Subject, func(msg *stan.Msg) {
+		handler(&consumerMessage{
+			Subject:      msg.Subject,
+			Sequence:     msg.Sequence,
+			Data:         msg.Data,
+			Redelivered:  msg.Redelivered,
+			Redeliveries: msg.RedeliveryCount,
+			ack:          msg.Ack,
+		})
+	},
+		stan.DurableName(c.cfg.DurableName),
+		stan.SetManualAckMode(),
+		stan.AckWait(c.cfg.AckWait),
+		stan.MaxInflight(c.cfg.MaxInflight),
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка установки подписки на NATS Streaming: %w", err)
+	}
+	return nil
+}
+
+// Время ожидания последнего сообщения канала; если его нет, канал считается пустым
+const stanReplayProbeWait = 2 * time.Second
+
+// Повторное чтение выполняется отдельной временной подпиской до последнего сообщения канала
+// на момент вызова
+func (c *stanConsumer) Replay(ctx context.Context, from replayPosition, handler func(msg *consumerMessage)) error {
+	last, lastTime, err := c.lastMessage(ctx)
+	if err != nil {
+		return err
+	}
+	if replayRangeEmpty(from, last, lastTime) {
+		return nil
+	}
+
+	start := stan.DeliverAllAvailable()
+	switch {
+	case from.Sequence > 0:
+		start = stan.StartAtSequence(from.Sequence)
+	case !from.Time.IsZero():
+		start = stan.StartAtTime(from.Time)
+	}
+
+	// Обработчик не вызывается после возврата из функции, даже если сервер ещё доставляет сообщения
+	var mu sync.Mutex
+	stopped := false
+	done := make(chan struct{})
+	sub, err := c.sc.Subscribe(c.cfg.Subject, func(msg *stan.Msg) {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return
+		}
+		handler(&consumerMessage{Subject: msg.Subject, Sequence: msg.Sequence, Data: msg.Data})
+		if msg.Sequence >= last {
+			stopped = true
+			close(done)
+		}
+	}, start)
+	if err != nil {
+		return fmt.Errorf("ошибка подписки для повторного чтения канала: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (c *stanConsumer) LastSequence(ctx context.Context) (uint64, error) {
+	last, _, err := c.lastMessage(ctx)
+	return last, err
+}
+
+// Функция получения номера и времени последнего сообщения канала, нулевые значения для пустого канала.
+// NATS Streaming не сообщает их напрямую, поэтому они определяются временной подпиской StartWithLastReceived.
+func (c *stanConsumer) lastMessage(ctx context.Context) (uint64, time.Time, error) {
+	lastCh := make(chan *stan.Msg, 1)
+	probe, err := c.sc.Subscribe(c.cfg.Subject, func(msg *stan.Msg) {
+		select {
+		case lastCh <- msg:
+		default:
+		}
+	}, stan.StartWithLastReceived())
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("ошибка определения последнего сообщения канала: %w", err)
+	}
+	defer probe.Unsubscribe()
+
+	select {
+	case msg := <-lastCh:
+		return msg.Sequence, time.Unix(0, msg.Timestamp), nil
+	case <-time.After(stanReplayProbeWait):
+		return 0, time.Time{}, nil
+	case <-ctx.Done():
+		return 0, time.Time{}, ctx.Err()
+	}
+}
+
+// Закрытие соединения без Unsubscribe, который удалил бы durable-подписку вместе с позицией в канале
+func (c *stanConsumer) Close() error {
+	return c.sc.Close()
+}
+
+// Функция подключения отправителя к NATS Streaming.
+// Соединение stan.Conn само реализует интерфейс orderPublisher.
+func newSTANPublisher(cfg NATSConfig, clientID string) (orderPublisher, error) {
+	sc, err := stan.Connect(cfg.ClusterID, clientID, stan.NatsURL(cfg.URL))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к NATS Streaming: %w", err)
+	}
+	return sc, nil
+}
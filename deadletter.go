@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Ошибка, возвращаемая хранилищем, если запись с указанным идентификатором отсутствует
+var ErrDeadLetterNotFound = errors.New("запись не найдена")
+
+// Сообщение, которое не удалось обработать.
+// Хранит исходные данные без изменений, чтобы после исправления причины его можно было обработать повторно.
+type DeadLetter struct {
+	ID        int64        `json:"id"`
+	Subject   string       `json:"subject"`
+	Sequence  uint64       `json:"sequence"`
+	Data      []byte       `json:"-"`
+	Error     string       `json:"error"`
+	Details   []FieldError `json:"details,omitempty"` // Ошибки проверки по полям, если заказ не прошёл проверку
+	Attempts  int          `json:"attempts"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Хранилище отклонённых сообщений
+type DeadLetterStore interface {
+	// Сохранение сообщения, возвращает присвоенный идентификатор
+	Add(ctx context.Context, letter DeadLetter) (int64, error)
+	// Получение страницы записей с идентификатором больше afterID
+	List(ctx context.Context, afterID int64, limit int) ([]DeadLetter, error)
+	// Получение записи по идентификатору, ErrDeadLetterNotFound если записи нет
+	Get(ctx context.Context, id int64) (DeadLetter, error)
+	// Удаление записи, ErrDeadLetterNotFound если записи нет
+	Delete(ctx context.Context, id int64) error
+	// Удаление всех записей, возвращает количество удалённых
+	Purge(ctx context.Context) (int64, error)
+}
+
+// Хранилище отклонённых сообщений, используемое приложением
+var deadLetters DeadLetterStore
+
+// Функция выбора хранилища отклонённых сообщений рядом с хранилищем заказов
+func openDeadLetterStore(r OrderRepository) DeadLetterStore {
+	switch r := r.(type) {
+	case *postgresRepository:
+		return &postgresDeadLetterStore{pool: r.pool}
+	case *sqliteRepository:
+		return &sqliteDeadLetterStore{db: r.db}
+	default:
+		return newMemoryDeadLetterStore()
+	}
+}
+
+// Функция сохранения сообщения, обработка которого завершилась окончательной ошибкой
+func storeDeadLetter(subject string, sequence uint64, data []byte, cause error, attempts int) error {
+	ctx, cancel := withQueryTimeout(context.Background())
+	defer cancel()
+
+	id, err := deadLetters.Add(ctx, DeadLetter{
+		Subject:   subject,
+		Sequence:  sequence,
+		Data:      data,
+		Error:     cause.Error(),
+		Details:   fieldErrors(cause),
+		Attempts:  attempts,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Сообщение %d сохранено в очередь отклонённых под номером %d", sequence, id)
+	return nil
+}
+
+// Функция получения ошибок проверки полей из цепочки ошибок, nil если их нет
+func fieldErrors(err error) []FieldError {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Fields
+	}
+	return nil
+}
+
+// Функция кодирования ошибок проверки полей для хранения в базе данных
+func encodeFieldErrors(fields []FieldError) []byte {
+	if len(fields) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(fields)
+	return data
+}
+
+// Функция декодирования ошибок проверки полей, сохранённых в базе данных
+func decodeFieldErrors(data []byte) ([]FieldError, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var fields []FieldError
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("ошибка чтения отчёта о проверке полей: %w", err)
+	}
+	return fields, nil
+}
+
+// Хранилище отклонённых сообщений в памяти процесса
+type memoryDeadLetterStore struct {
+	mu      sync.Mutex
+	nextID  int64
+	letters map[int64]DeadLetter
+}
+
+// Функция создания пустого хранилища отклонённых сообщений в памяти
+func newMemoryDeadLetterStore() *memoryDeadLetterStore {
+	return &memoryDeadLetterStore{letters: make(map[int64]DeadLetter)}
+}
+
+func (s *memoryDeadLetterStore) Add(ctx context.Context, letter DeadLetter) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	letter.ID = s.nextID
+	letter.Data = append([]byte(nil), letter.Data...)
+	s.letters[letter.ID] = letter
+	return letter.ID, nil
+}
+
+func (s *memoryDeadLetterStore) List(ctx context.Context, afterID int64, limit int) ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var letters []DeadLetter
+	for id, letter := range s.letters {
+		if id > afterID {
+			letters = append(letters, letter)
+		}
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i].ID < letters[j].ID })
+	if len(letters) > limit {
+		letters = letters[:limit]
+	}
+	return letters, nil
+}
+
+func (s *memoryDeadLetterStore) Get(ctx context.Context, id int64) (DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letter, ok := s.letters[id]
+	if !ok {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	return letter, nil
+}
+
+func (s *memoryDeadLetterStore) Delete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.letters[id]; !ok {
+		return ErrDeadLetterNotFound
+	}
+	delete(s.letters, id)
+	return nil
+}
+
+func (s *memoryDeadLetterStore) Purge(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := int64(len(s.letters))
+	s.letters = make(map[int64]DeadLetter)
+	return n, nil
+}
+
+// Подробное представление отклонённого сообщения вместе с исходными данными.
+// Данные передаются без изменений в base64: сообщение могло быть отклонено как раз
+// из-за того, что не является корректным UTF-8 или JSON.
+type deadLetterDetails struct {
+	DeadLetter
+	Payload []byte `json:"payload"`
+}
+
+// Ответ на неудачную повторную обработку отклонённого сообщения
+type redriveFailure struct {
+	Error   string       `json:"error"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// Функция регистрации обработчиков управления отклонёнными сообщениями
+func registerDeadLetterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/dead-letters", listDeadLettersHandler)
+	mux.HandleFunc("DELETE /admin/dead-letters", purgeDeadLettersHandler)
+	mux.HandleFunc("GET /admin/dead-letters/{id}", getDeadLetterHandler)
+	mux.HandleFunc("DELETE /admin/dead-letters/{id}", deleteDeadLetterHandler)
+	mux.HandleFunc("POST /admin/dead-letters/{id}/redrive", redriveDeadLetterHandler)
+}
+
+// Обработчик получения списка отклонённых сообщений: ?after_id=&limit=
+func listDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	afterID, err := queryInt(r, "after_id", 0)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiError{Code: errCodeInvalidParameter, Message: err.Error(), Field: "after_id"})
+		return
+	}
+	limit, err := queryInt(r, "limit", 100)
+	if err != nil || limit < 1 || limit > 1000 {
+		writeAPIError(w, http.StatusBadRequest, apiError{Code: errCodeInvalidParameter, Message: "limit должен быть в диапазоне 1-1000", Field: "limit"})
+		return
+	}
+
+	letters, err := deadLetters.List(r.Context(), int64(afterID), limit)
+	if err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+	if letters == nil {
+		letters = []DeadLetter{}
+	}
+	writeJSON(w, http.StatusOK, letters)
+}
+
+// Обработчик просмотра отклонённого сообщения вместе с исходными данными
+func getDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	letter, ok := loadDeadLetter(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, deadLetterDetails{DeadLetter: letter, Payload: letter.Data})
+}
+
+// Обработчик удаления отклонённого сообщения
+func deleteDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := deadLetterID(w, r)
+	if !ok {
+		return
+	}
+	if err := deadLetters.Delete(r.Context(), id); err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Обработчик удаления всех отклонённых сообщений
+func purgeDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := deadLetters.Purge(r.Context())
+	if err != nil {
+		writeDeadLetterError(w, err)
+		return
+	}
+	log.Printf("Очередь отклонённых сообщений очищена, удалено %d", n)
+	writeJSON(w, http.StatusOK, map[string]int64{"purged": n})
+}
+
+// Обработчик повторной обработки отклонённого сообщения.
+// При успехе запись удаляется, при ошибке остаётся в очереди. Если сообщение по-прежнему
+// некорректно, возвращается 422 с причиной; при временной ошибке хранилища заказов - 503,
+// и повторную обработку можно выполнить позже.
+func redriveDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	letter, ok := loadDeadLetter(w, r)
+	if !ok {
+		return
+	}
+
+	if err := processOrderMessage(r.Context(), letter.Data); err != nil {
+		if !isPermanent(err) {
+			log.Printf("Ошибка повторной обработки отклонённого сообщения %d: %v", letter.ID, err)
+			writeAPIError(w, http.StatusServiceUnavailable, apiError{Code: errCodeStorageUnavailable, Message: "Хранилище заказов недоступно, повторите запрос позже"})
+			return
+		}
+		writeJSON(w, http.StatusUnprocessableEntity, redriveFailure{Error: err.Error(), Details: fieldErrors(err)})
+		return
+	}
+
+	if err := deadLetters.Delete(r.Context(), letter.ID); err != nil && !errors.Is(err, ErrDeadLetterNotFound) {
+		log.Printf("Сообщение %d обработано, но не удалено из очереди: %v", letter.ID, err)
+	}
+	log.Printf("Отклонённое сообщение %d успешно обработано повторно", letter.ID)
+	writeJSON(w, http.StatusOK, map[string]string{"status": "redriven"})
+}
+
+// Функция загрузки отклонённого сообщения по идентификатору из пути запроса
+func loadDeadLetter(w http.ResponseWriter, r *http.Request) (DeadLetter, bool) {
+	id, ok := deadLetterID(w, r)
+	if !ok {
+		return DeadLetter{}, false
+	}
+	letter, err := deadLetters.Get(r.Context(), id)
+	if err != nil {
+		writeDeadLetterError(w, err)
+		return DeadLetter{}, false
+	}
+	return letter, true
+}
+
+// Функция чтения идентификатора отклонённого сообщения из пути запроса
+func deadLetterID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeAPIError(w, http.StatusBadRequest, apiError{Code: errCodeInvalidParameter, Message: "Идентификатор записи должен быть положительным числом", Field: "id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// Функция ответа на ошибку хранилища отклонённых сообщений
+func writeDeadLetterError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrDeadLetterNotFound) {
+		writeAPIError(w, http.StatusNotFound, apiError{Code: errCodeDeadLetterNotFound, Message: "Запись не найдена"})
+		return
+	}
+	log.Printf("Ошибка хранилища отклонённых сообщений: %v", err)
+	writeAPIError(w, http.StatusServiceUnavailable, apiError{Code: errCodeStorageUnavailable, Message: "Хранилище отклонённых сообщений недоступно"})
+}
+
+// Функция чтения целочисленного параметра запроса со значением по умолчанию
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.New("параметр " + name + " должен быть числом")
+	}
+	return n, nil
+}
+
+// Функция записи ответа в формате JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Хранилище отклонённых сообщений в таблице dead_letters PostgreSQL
+type postgresDeadLetterStore struct {
+	pool *pgxpool.Pool
+}
+
+func (s *postgresDeadLetterStore) Add(ctx context.Context, letter DeadLetter) (int64, error) {
+	var id int64
+	err := s.pool.QueryRow(ctx,
+		"INSERT INTO dead_letters (subject, sequence, payload, error, details, attempts, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		letter.Subject, int64(letter.Sequence), letter.Data, letter.Error, encodeFieldErrors(letter.Details), letter.Attempts, letter.CreatedAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения отклонённого сообщения в PostgreSQL: %w", err)
+	}
+	return id, nil
+}
+
+func (s *postgresDeadLetterStore) List(ctx context.Context, afterID int64, limit int) ([]DeadLetter, error) {
+	rows, err := s.pool.Query(ctx,
+		"SELECT id, subject, sequence, payload, error, details, attempts, created_at FROM dead_letters WHERE id > $1 ORDER BY id LIMIT $2",
+		afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса отклонённых сообщений из PostgreSQL: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []DeadLetter
+	for rows.Next() {
+		letter, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	return letters, rows.Err()
+}
+
+func (s *postgresDeadLetterStore) Get(ctx context.Context, id int64) (DeadLetter, error) {
+	row := s.pool.QueryRow(ctx,
+		"SELECT id, subject, sequence, payload, error, details, attempts, created_at FROM dead_letters WHERE id = $1", id)
+	letter, err := scanDeadLetter(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	return letter, err
+}
+
+func (s *postgresDeadLetterStore) Delete(ctx context.Context, id int64) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM dead_letters WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления отклонённого сообщения: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+func (s *postgresDeadLetterStore) Purge(ctx context.Context) (int64, error) {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM dead_letters")
+	if err != nil {
+		return 0, fmt.Errorf("ошибка очистки отклонённых сообщений: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Функция чтения отклонённого сообщения из строки результата
+func scanDeadLetter(row pgx.Row) (DeadLetter, error) {
+	var letter DeadLetter
+	var sequence int64
+	var details []byte
+	err := row.Scan(&letter.ID, &letter.Subject, &sequence, &letter.Data, &letter.Error, &details, &letter.Attempts, &letter.CreatedAt)
+	if err != nil {
+		return letter, err
+	}
+	letter.Sequence = uint64(sequence)
+	letter.Details, err = decodeFieldErrors(details)
+	return letter, err
+}
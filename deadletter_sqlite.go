@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Хранилище отклонённых сообщений в таблице dead_letters SQLite
+type sqliteDeadLetterStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteDeadLetterStore) Add(ctx context.Context, letter DeadLetter) (int64, error) {
+	res, err := s.db.ExecContext(ctx,
+		"INSERT INTO dead_letters (subject, sequence, payload, error, details, attempts, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		letter.Subject, int64(letter.Sequence), letter.Data, letter.Error, encodeFieldErrors(letter.Details), letter.Attempts, letter.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения отклонённого сообщения в SQLite: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+func (s *sqliteDeadLetterStore) List(ctx context.Context, afterID int64, limit int) ([]DeadLetter, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT id, subject, sequence, payload, error, details, attempts, created_at FROM dead_letters WHERE id > ? ORDER BY id LIMIT ?",
+		afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса отклонённых сообщений из SQLite: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []DeadLetter
+	for rows.Next() {
+		letter, err := scanSQLiteDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	return letters, rows.Err()
+}
+
+func (s *sqliteDeadLetterStore) Get(ctx context.Context, id int64) (DeadLetter, error) {
+	row := s.db.QueryRowContext(ctx,
+		"SELECT id, subject, sequence, payload, error, details, attempts, created_at FROM dead_letters WHERE id = ?", id)
+	letter, err := scanSQLiteDeadLetter(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	return letter, err
+}
+
+func (s *sqliteDeadLetterStore) Delete(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM dead_letters WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления отклонённого сообщения: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+func (s *sqliteDeadLetterStore) Purge(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM dead_letters")
+	if err != nil {
+		return 0, fmt.Errorf("ошибка очистки отклонённых сообщений: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// Общий интерфейс sql.Row и sql.Rows для чтения одной строки
+type sqlScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Функция чтения отклонённого сообщения из строки результата
+func scanSQLiteDeadLetter(row sqlScanner) (DeadLetter, error) {
+	var letter DeadLetter
+	var sequence int64
+	var details []byte
+	err := row.Scan(&letter.ID, &letter.Subject, &sequence, &letter.Data, &letter.Error, &details, &letter.Attempts, &letter.CreatedAt)
+	if err != nil {
+		return letter, err
+	}
+	letter.Sequence = uint64(sequence)
+	letter.Details, err = decodeFieldErrors(details)
+	return letter, err
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Общие проверки поведения для всех реализаций хранилища отклонённых сообщений
+func testDeadLetterStore(t *testing.T, store DeadLetterStore) {
+	ctx := context.Background()
+
+	var ids []int64
+	for seq := uint64(1); seq <= 3; seq++ {
+		id, err := store.Add(ctx, DeadLetter{Subject: "orders", Sequence: seq, Data: []byte("{}"), Error: "ошибка", Attempts: 1, CreatedAt: time.Now().UTC(),
+			Details: []FieldError{{Field: "order_uid", Code: "required", Message: "обязательное поле"}}})
+		if err != nil {
+			t.Fatalf("Ошибка сохранения отклонённого сообщения: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	letters, err := store.List(ctx, ids[0], 10)
+	if err != nil || len(letters) != 2 || letters[0].ID != ids[1] {
+		t.Errorf("Ожидались записи после %d, получено: %+v, %v", ids[0], letters, err)
+	}
+
+	letter, err := store.Get(ctx, ids[2])
+	if err != nil || letter.Sequence != 3 || string(letter.Data) != "{}" || len(letter.Details) != 1 || letter.Details[0].Field != "order_uid" {
+		t.Errorf("Ожидалась запись с sequence 3, получено: %+v, %v", letter, err)
+	}
+
+	if err := store.Delete(ctx, ids[0]); err != nil {
+		t.Errorf("Ошибка удаления записи: %v", err)
+	}
+	if _, err := store.Get(ctx, ids[0]); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Ожидалась ошибка ErrDeadLetterNotFound, получено: %v", err)
+	}
+
+	if n, err := store.Purge(ctx); err != nil || n != 2 {
+		t.Errorf("Ожидалось удаление 2 записей, получено: %d, %v", n, err)
+	}
+}
+
+func TestMemoryDeadLetterStore(t *testing.T) {
+	testDeadLetterStore(t, newMemoryDeadLetterStore())
+}
+
+func TestSQLiteDeadLetterStore(t *testing.T) {
+	repo, err := newSQLiteRepository(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Ошибка открытия SQLite: %v", err)
+	}
+	defer repo.Close()
+
+	testDeadLetterStore(t, openDeadLetterStore(repo))
+}
+
+func TestRedriveDeadLetterHandler(t *testing.T) {
+	useTestRepository(t, newMemoryRepository())
+	previous := deadLetters
+	deadLetters = newMemoryDeadLetterStore()
+	defer func() { deadLetters = previous }()
+
+	mux := http.NewServeMux()
+	registerDeadLetterHandlers(mux)
+
+	order := newTestOrder("redrive-test")
+	data, _ := json.Marshal(order)
+	id, _ := deadLetters.Add(context.Background(), DeadLetter{Subject: "orders", Sequence: 1, Data: data, Error: "временная ошибка"})
+	defer orderCache.Delete(order.OrderUID)
+
+	// Просмотр записи возвращает исходные данные
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/admin/dead-letters/"+strconv.FormatInt(id, 10), nil))
+	var details deadLetterDetails
+	if err := json.NewDecoder(recorder.Body).Decode(&details); err != nil || !bytes.Equal(details.Payload, data) {
+		t.Errorf("Ожидались исходные данные сообщения, получено: %+v, %v", details, err)
+	}
+
+	// Повторная обработка сохраняет заказ и удаляет запись
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("POST", "/admin/dead-letters/"+strconv.FormatInt(id, 10)+"/redrive", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Ожидался код состояния %d, получено: %d (%s)", http.StatusOK, recorder.Code, recorder.Body)
+	}
+	if _, err := repo.Get(context.Background(), order.OrderUID); err != nil {
+		t.Errorf("Заказ не сохранён после повторной обработки: %v", err)
+	}
+	if _, err := deadLetters.Get(context.Background(), id); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("Запись должна быть удалена после успешной обработки, получено: %v", err)
+	}
+
+	// Некорректное сообщение остаётся в очереди
+	badID, _ := deadLetters.Add(context.Background(), DeadLetter{Data: []byte("{not json")})
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("POST", "/admin/dead-letters/"+strconv.FormatInt(badID, 10)+"/redrive", nil))
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Ожидался код состояния %d, получено: %d", http.StatusUnprocessableEntity, recorder.Code)
+	}
+
+	// Данные, не являющиеся UTF-8, возвращаются без искажений
+	binary := []byte{0xff, 0xfe, 0x00, '{'}
+	binaryID, _ := deadLetters.Add(context.Background(), DeadLetter{Data: binary})
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("GET", "/admin/dead-letters/"+strconv.FormatInt(binaryID, 10), nil))
+	details = deadLetterDetails{}
+	if err := json.NewDecoder(recorder.Body).Decode(&details); err != nil || !bytes.Equal(details.Payload, binary) {
+		t.Errorf("Ожидались исходные байты сообщения, получено: %v, %v", details.Payload, err)
+	}
+}
+
+func TestRedriveDeadLetterHandler_StorageUnavailable(t *testing.T) {
+	useTestRepository(t, stalledRepository{})
+	useTestConfig(t, func(cfg *Config) { cfg.DB.QueryTimeout = 10 * time.Millisecond })
+	previous := deadLetters
+	deadLetters = newMemoryDeadLetterStore()
+	defer func() { deadLetters = previous }()
+
+	mux := http.NewServeMux()
+	registerDeadLetterHandlers(mux)
+
+	data, _ := json.Marshal(newTestOrder("redrive-unavailable"))
+	id, _ := deadLetters.Add(context.Background(), DeadLetter{Data: data})
+
+	// Временная ошибка хранилища заказов - не повод считать сообщение некорректным
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest("POST", "/admin/dead-letters/"+strconv.FormatInt(id, 10)+"/redrive", nil))
+	expectAPIError(t, recorder, errCodeStorageUnavailable)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Ожидался код состояния %d, получено: %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+	if _, err := deadLetters.Get(context.Background(), id); err != nil {
+		t.Errorf("Запись должна остаться в очереди, получено: %v", err)
+	}
+}
+
+// Хранилище отклонённых сообщений, все операции которого завершаются ошибкой
+type failingDeadLetterStore struct {
+	DeadLetterStore
+}
+
+func (failingDeadLetterStore) List(ctx context.Context, afterID int64, limit int) ([]DeadLetter, error) {
+	return nil, errors.New("хранилище недоступно")
+}
+
+func (failingDeadLetterStore) Purge(ctx context.Context) (int64, error) {
+	return 0, errors.New("хранилище недоступно")
+}
+
+func TestDeadLetterHandlers_Errors(t *testing.T) {
+	previous := deadLetters
+	deadLetters = newMemoryDeadLetterStore()
+	defer func() { deadLetters = previous }()
+
+	mux := http.NewServeMux()
+	registerDeadLetterHandlers(mux)
+	check := func(method, target string, status int, code string) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+		if recorder.Code != status {
+			t.Errorf("%s %s: ожидался код состояния %d, получено: %d", method, target, status, recorder.Code)
+		}
+		expectAPIError(t, recorder, code)
+	}
+
+	check("GET", "/admin/dead-letters?after_id=x", http.StatusBadRequest, errCodeInvalidParameter)
+	check("GET", "/admin/dead-letters?limit=0", http.StatusBadRequest, errCodeInvalidParameter)
+	check("GET", "/admin/dead-letters/abc", http.StatusBadRequest, errCodeInvalidParameter)
+	check("DELETE", "/admin/dead-letters/-1", http.StatusBadRequest, errCodeInvalidParameter)
+	check("GET", "/admin/dead-letters/42", http.StatusNotFound, errCodeDeadLetterNotFound)
+	check("DELETE", "/admin/dead-letters/42", http.StatusNotFound, errCodeDeadLetterNotFound)
+	check("POST", "/admin/dead-letters/42/redrive", http.StatusNotFound, errCodeDeadLetterNotFound)
+
+	deadLetters = failingDeadLetterStore{}
+	check("GET", "/admin/dead-letters", http.StatusServiceUnavailable, errCodeStorageUnavailable)
+	check("DELETE", "/admin/dead-letters", http.StatusServiceUnavailable, errCodeStorageUnavailable)
+}
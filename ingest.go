@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Ошибка обработки сообщения, которую не исправит повторная доставка
+// (например, некорректный JSON). Такие сообщения подтверждаются сразу.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Функция проверки, что ошибка обработки сообщения не исправится при повторе
+func isPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
+
+// Функция обработки сообщения с заказом: разбор JSON, проверка полей и сохранение в хранилище и кеш.
+// Ошибки хранилища считаются временными и приводят к повторной доставке.
+func processOrderMessage(ctx context.Context, data []byte) error {
+	var orderData Order
+	if err := json.Unmarshal(data, &orderData); err != nil {
+		return &permanentError{fmt.Errorf("ошибка десериализации данных заказа: %w", err)}
+	}
+
+	// Заказ с некорректными полями не сохраняется, отчёт о полях попадает в очередь отклонённых
+	if err := orderData.Validate(); err != nil {
+		return &permanentError{err}
+	}
+
+	// Сохранение данных в базе данных и кэше
+	if err := saveOrder(ctx, orderData); err != nil {
+		if errors.Is(err, ErrOrderConflict) {
+			return &permanentError{fmt.Errorf("заказ %s: %w", orderData.OrderUID, err)}
+		}
+		return fmt.Errorf("ошибка сохранения заказа %s: %w", orderData.OrderUID, err)
+	}
+	return nil
+}
+
+// Приём заказов из брокера с учётом сообщений, находящихся в обработке
+type ingestion struct {
+	consumer     OrderConsumer
+	redeliveries *redeliveryTracker
+
+	mu       sync.Mutex
+	stopping bool
+	inflight sync.WaitGroup
+}
+
+// Функция запуска приёма заказов через подключённого получателя (см. newOrderConsumer).
+// При ошибке подписки соединение получателя закрывается.
+func startIngestion(cfg NATSConfig, consumer OrderConsumer) (*ingestion, error) {
+	in := &ingestion{consumer: consumer, redeliveries: newRedeliveryTracker()}
+	if err := consumer.Subscribe(in.handle); err != nil {
+		consumer.Close()
+		return nil, err
+	}
+	log.Printf("Подписка на канал %s установлена (транспорт %s)", cfg.Subject, cfg.Transport)
+	return in, nil
+}
+
+// Функция обработки сообщения, если приём ещё не остановлен.
+// Сообщения, пришедшие после остановки, не подтверждаются и будут доставлены повторно после перезапуска.
+func (in *ingestion) handle(msg *consumerMessage) {
+	in.mu.Lock()
+	if in.stopping {
+		in.mu.Unlock()
+		return
+	}
+	in.inflight.Add(1)
+	in.mu.Unlock()
+	defer in.inflight.Done()
+
+	handleOrderMessage(msg, in.redeliveries)
+}
+
+// Функция остановки приёма: новые сообщения больше не обрабатываются, начатые сохранения
+// дожидаются фиксации, после чего соединение закрывается без отмены durable-подписки.
+// Если обработка не завершилась до отмены ctx, возвращается ошибка, а соединение всё равно закрывается.
+func (in *ingestion) Stop(ctx context.Context) error {
+	in.mu.Lock()
+	in.stopping = true
+	in.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		in.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("обработка сообщений не завершилась до истечения времени остановки: %w", ctx.Err())
+	}
+	if closeErr := in.consumer.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("ошибка закрытия подписки: %w", closeErr)
+	}
+	return err
+}
+
+// Функция обработки полученного сообщения и его подтверждения.
+// Сообщение подтверждается после фиксации заказа или после сохранения в очередь отклонённых;
+// при временной ошибке подтверждение не отправляется, и сервер доставит сообщение повторно.
+func handleOrderMessage(msg *consumerMessage, redeliveries *redeliveryTracker) {
+	attempt := redeliveries.attempt(msg.Sequence, msg.Redeliveries)
+	if msg.Redelivered {
+		log.Printf("Повторная доставка сообщения %d, попытка %d", msg.Sequence, attempt)
+	}
+
+	err := processOrderMessage(context.Background(), msg.Data)
+	maxRedeliveries := currentConfig().Ingest.MaxRedeliveries
+	switch {
+	case err == nil:
+	case isPermanent(err) || (maxRedeliveries > 0 && attempt > maxRedeliveries):
+		log.Printf("Сообщение %d отклонено после %d попыток: %v", msg.Sequence, attempt, err)
+		// Без сохранения в очередь отклонённых сообщение нельзя подтверждать, иначе оно потеряется
+		if err := storeDeadLetter(msg.Subject, msg.Sequence, msg.Data, err, attempt); err != nil {
+			log.Printf("Ошибка сохранения отклонённого сообщения %d: %v", msg.Sequence, err)
+			return
+		}
+	default:
+		log.Printf("Сообщение %d будет доставлено повторно: %v", msg.Sequence, err)
+		return
+	}
+
+	if err := msg.Ack(); err != nil {
+		log.Printf("Ошибка подтверждения сообщения %d: %v", msg.Sequence, err)
+		return
+	}
+	redeliveries.done(msg.Sequence)
+	markSequenceApplied(msg.Sequence)
+}
+
+// Учёт попыток обработки неподтверждённых сообщений по их номеру в канале
+type redeliveryTracker struct {
+	mu       sync.Mutex
+	attempts map[uint64]int
+}
+
+// Функция создания пустого учёта попыток
+func newRedeliveryTracker() *redeliveryTracker {
+	return &redeliveryTracker{attempts: make(map[uint64]int)}
+}
+
+// Функция регистрации очередной попытки обработки сообщения.
+// Сервер сообщает собственный счётчик повторов, но в NATS Streaming он теряется при
+// перезапуске сервера, поэтому используется большее из двух значений.
+func (t *redeliveryTracker) attempt(sequence uint64, serverRedeliveries uint32) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := t.attempts[sequence] + 1
+	if fromServer := int(serverRedeliveries) + 1; fromServer > n {
+		n = fromServer
+	}
+	t.attempts[sequence] = n
+	return n
+}
+
+// Функция удаления учёта для подтверждённого сообщения
+func (t *redeliveryTracker) done(sequence uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.attempts, sequence)
+}
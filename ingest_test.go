@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Функция подмены хранилища на время теста
+func useTestRepository(t *testing.T, r OrderRepository) {
+	previous := repo
+	repo = r
+	t.Cleanup(func() { repo = previous })
+}
+
+// Функция подмены конфигурации на время теста
+func useTestConfig(t *testing.T, change func(cfg *Config)) {
+	previous := appConfig.Load()
+	cfg := defaultConfig()
+	change(&cfg)
+	appConfig.Store(&cfg)
+	t.Cleanup(func() { appConfig.Store(previous) })
+}
+
+func TestProcessOrderMessage(t *testing.T) {
+	useTestRepository(t, newMemoryRepository())
+	useTestConfig(t, func(cfg *Config) { cfg.Ingest.DuplicatePolicy = DuplicateRejectIfDifferent })
+
+	order := newTestOrder("ingest-test")
+	data, _ := json.Marshal(order)
+	defer orderCache.Delete(order.OrderUID)
+
+	if err := processOrderMessage(context.Background(), data); err != nil {
+		t.Fatalf("Ошибка обработки корректного сообщения: %v", err)
+	}
+	_, cached := orderCache.Get(order.OrderUID)
+	if !cached {
+		t.Error("Заказ не попал в кеш после сохранения")
+	}
+
+	// Повторная доставка того же заказа обрабатывается без ошибки
+	if err := processOrderMessage(context.Background(), data); err != nil {
+		t.Errorf("Ошибка обработки повторного сообщения: %v", err)
+	}
+
+	// Отличающийся заказ с тем же order_uid отклоняется окончательно
+	order.Delivery.City = "Moscow"
+	changed, _ := json.Marshal(order)
+	if err := processOrderMessage(context.Background(), changed); !isPermanent(err) {
+		t.Errorf("Ожидалась окончательная ошибка для конфликтующего заказа, получено: %v", err)
+	}
+
+	// Заказ без обязательных полей отклоняется с отчётом по полям
+	err := processOrderMessage(context.Background(), []byte("{}"))
+	if _, ok := findFieldError(err, "order_uid"); !ok || !isPermanent(err) {
+		t.Errorf("Ожидалась окончательная ошибка проверки для пустого заказа, получено: %v", err)
+	}
+
+	if err := processOrderMessage(context.Background(), []byte("{not json")); !isPermanent(err) {
+		t.Errorf("Ожидалась окончательная ошибка для некорректного JSON, получено: %v", err)
+	}
+}
+
+func TestHandleOrderMessage(t *testing.T) {
+	useTestRepository(t, newMemoryRepository())
+	useTestConfig(t, func(cfg *Config) {})
+	previous := deadLetters
+	deadLetters = newMemoryDeadLetterStore()
+	defer func() { deadLetters = previous }()
+
+	order := newTestOrder("handle-test")
+	data, _ := json.Marshal(order)
+	defer orderCache.Delete(order.OrderUID)
+
+	redeliveries := newRedeliveryTracker()
+	deliver := func(sequence uint64, data []byte) bool {
+		acked := false
+		handleOrderMessage(&consumerMessage{
+			Subject:  "orders",
+			Sequence: sequence,
+			Data:     data,
+			ack:      func() error { acked = true; return nil },
+		}, redeliveries)
+		return acked
+	}
+
+	if !deliver(1, data) {
+		t.Error("Сохранённый заказ должен быть подтверждён")
+	}
+
+	// Некорректное сообщение подтверждается только после сохранения в очередь отклонённых
+	if !deliver(2, []byte("{}")) {
+		t.Error("Отклонённое сообщение должно быть подтверждено")
+	}
+	letters, _ := deadLetters.List(context.Background(), 0, 10)
+	if len(letters) != 1 || letters[0].Sequence != 2 || len(letters[0].Details) == 0 {
+		t.Errorf("Ожидалась запись об отклонённом сообщении 2 с отчётом по полям, получено: %+v", letters)
+	}
+}
+
+// Получатель сообщений для тестов, запоминающий закрытие
+type fakeConsumer struct {
+	closed bool
+
+	// Сообщения и ошибка, возвращаемые Replay
+	replay    []*consumerMessage
+	replayErr error
+}
+
+func (c *fakeConsumer) Subscribe(handler func(msg *consumerMessage)) error { return nil }
+func (c *fakeConsumer) Close() error                                       { c.closed = true; return nil }
+func (c *fakeConsumer) Replay(ctx context.Context, from replayPosition, handler func(msg *consumerMessage)) error {
+	for _, msg := range c.replay {
+		if msg.Sequence >= from.Sequence {
+			handler(msg)
+		}
+	}
+	return c.replayErr
+}
+func (c *fakeConsumer) LastSequence(ctx context.Context) (uint64, error) {
+	var last uint64
+	for _, msg := range c.replay {
+		last = max(last, msg.Sequence)
+	}
+	return last, c.replayErr
+}
+
+func TestIngestionStop(t *testing.T) {
+	useTestRepository(t, newMemoryRepository())
+	consumer := &fakeConsumer{}
+	in := &ingestion{consumer: consumer, redeliveries: newRedeliveryTracker()}
+
+	// Незавершённая обработка задерживает остановку до истечения времени
+	in.inflight.Add(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := in.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Ожидалась ошибка истечения времени остановки, получено: %v", err)
+	}
+	if !consumer.closed {
+		t.Error("Соединение должно закрываться даже при истечении времени остановки")
+	}
+	in.inflight.Done()
+
+	// После остановки сообщения не обрабатываются и не подтверждаются
+	data, _ := json.Marshal(newTestOrder("after-stop"))
+	acked := false
+	in.handle(&consumerMessage{Sequence: 1, Data: data, ack: func() error { acked = true; return nil }})
+	if acked {
+		t.Error("Сообщение, полученное после остановки, не должно подтверждаться")
+	}
+}
+
+func TestRedeliveryTracker(t *testing.T) {
+	tracker := newRedeliveryTracker()
+
+	if n := tracker.attempt(7, 0); n != 1 {
+		t.Errorf("Ожидалась попытка 1, получено: %d", n)
+	}
+	if n := tracker.attempt(7, 0); n != 2 {
+		t.Errorf("Ожидалась попытка 2, получено: %d", n)
+	}
+	// Счётчик сервера больше локального после перезапуска сервиса
+	if n := tracker.attempt(8, 4); n != 5 {
+		t.Errorf("Ожидалась попытка 5 по счётчику сервера, получено: %d", n)
+	}
+
+	tracker.done(7)
+	if n := tracker.attempt(7, 0); n != 1 {
+		t.Errorf("После подтверждения учёт должен начинаться заново, получено: %d", n)
+	}
+}
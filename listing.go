@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Поля сортировки списка заказов
+const (
+	SortByUID     = "order_uid"
+	SortByCreated = "date_created"
+)
+
+// Условия отбора заказов для списка. Пустые поля не ограничивают выборку.
+type OrderFilter struct {
+	CustomerID      string
+	DeliveryService string
+	Entry           string
+	Locale          string
+	Currency        string
+	Provider        string
+	TrackNumber     string
+	Transaction     string
+	// Диапазон date_created: [CreatedFrom, CreatedTo)
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+// Функция проверки, что заказ удовлетворяет условиям отбора.
+// Используется хранилищем в памяти и списком по кешу; PostgreSQL и SQLite
+// применяют те же условия в SQL (см. buildListQuery).
+func (f OrderFilter) Matches(o Order) bool {
+	if (f.CustomerID != "" && o.CustomerID != f.CustomerID) ||
+		(f.DeliveryService != "" && o.DeliveryService != f.DeliveryService) ||
+		(f.Entry != "" && o.Entry != f.Entry) ||
+		(f.Locale != "" && o.Locale != f.Locale) ||
+		(f.Currency != "" && o.Payment.Currency != f.Currency) ||
+		(f.Provider != "" && o.Payment.Provider != f.Provider) ||
+		(f.TrackNumber != "" && o.TrackNumber != f.TrackNumber) ||
+		(f.Transaction != "" && o.Payment.Transaction != f.Transaction) {
+		return false
+	}
+	if f.CreatedFrom.IsZero() && f.CreatedTo.IsZero() {
+		return true
+	}
+	created, ok := orderCreatedAt(o)
+	return ok && (f.CreatedFrom.IsZero() || !created.Before(f.CreatedFrom)) &&
+		(f.CreatedTo.IsZero() || created.Before(f.CreatedTo))
+}
+
+// Функция получения момента создания заказа. Заказы с date_created не в формате RFC3339
+// (сохранённые до появления проверки полей) не попадают в выборки по дате.
+func orderCreatedAt(o Order) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, o.DateCreated)
+	return t, err == nil
+}
+
+// Позиция в списке, после которой начинается следующая страница (keyset)
+type listKey struct {
+	Created time.Time // Значение date_created последнего заказа страницы при сортировке по дате
+	UID     string    // order_uid последнего заказа страницы
+}
+
+// Функция сравнения позиций в порядке сортировки по возрастанию
+func (k listKey) less(other listKey, sortBy string) bool {
+	if sortBy == SortByCreated && !k.Created.Equal(other.Created) {
+		return k.Created.Before(other.Created)
+	}
+	return k.UID < other.UID
+}
+
+// Функция получения позиции заказа в списке
+func orderListKey(o Order, sortBy string) (listKey, bool) {
+	key := listKey{UID: o.OrderUID}
+	if sortBy == SortByCreated {
+		created, ok := orderCreatedAt(o)
+		if !ok {
+			return key, false
+		}
+		key.Created = created
+	}
+	return key, true
+}
+
+// Функция выбора страницы из набора заказов в памяти по условиям запроса.
+// Порядок и границы страниц совпадают с SQL-реализацией, поэтому курсор,
+// полученный по кешу, продолжает тот же список и в хранилище.
+func selectOrderPage(orders []Order, query ListQuery) []Order {
+	type keyed struct {
+		key   listKey
+		order Order
+	}
+	var matched []keyed
+	for _, o := range orders {
+		if !query.Filter.Matches(o) {
+			continue
+		}
+		key, ok := orderListKey(o, query.SortBy())
+		if !ok {
+			continue
+		}
+		if query.After != nil {
+			if query.Descending && !key.less(*query.After, query.SortBy()) {
+				continue
+			}
+			if !query.Descending && !query.After.less(key, query.SortBy()) {
+				continue
+			}
+		}
+		matched = append(matched, keyed{key, o})
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if query.Descending {
+			return matched[j].key.less(matched[i].key, query.SortBy())
+		}
+		return matched[i].key.less(matched[j].key, query.SortBy())
+	})
+	if len(matched) > query.Limit {
+		matched = matched[:query.Limit]
+	}
+	page := make([]Order, len(matched))
+	for i, m := range matched {
+		page[i] = m.order
+	}
+	return page
+}
+
+// Диалект SQL для построения запроса списка
+type listDialect struct {
+	placeholder func(n int) string            // Обозначение n-го параметра, начиная с 1
+	uid         string                        // Выражение order_uid для сравнения и сортировки в порядке байтов, как в Go
+	created     string                        // Выражение момента создания заказа, NULL для некорректной даты
+	createdArg  func(ph string) string        // Выражение момента времени из параметра
+	timeArg     func(t time.Time) interface{} // Значение параметра для момента времени
+}
+
+// Функция построения условий, сортировки и ограничения SQL-запроса списка
+func buildListQuery(query ListQuery, d listDialect) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return d.placeholder(len(args))
+	}
+
+	for _, f := range []struct{ column, value string }{
+		{"o.customer_id", query.Filter.CustomerID},
+		{"o.delivery_service", query.Filter.DeliveryService},
+		{"o.entry", query.Filter.Entry},
+		{"o.locale", query.Filter.Locale},
+		{"p.currency", query.Filter.Currency},
+		{"p.provider", query.Filter.Provider},
+		{"o.track_number", query.Filter.TrackNumber},
+		{`p."transaction"`, query.Filter.Transaction},
+	} {
+		if f.value != "" {
+			conds = append(conds, f.column+" = "+arg(f.value))
+		}
+	}
+	if !query.Filter.CreatedFrom.IsZero() {
+		conds = append(conds, d.created+" >= "+d.createdArg(arg(d.timeArg(query.Filter.CreatedFrom))))
+	}
+	if !query.Filter.CreatedTo.IsZero() {
+		conds = append(conds, d.created+" < "+d.createdArg(arg(d.timeArg(query.Filter.CreatedTo))))
+	}
+
+	op, dir := ">", "ASC"
+	if query.Descending {
+		op, dir = "<", "DESC"
+	}
+	order := d.uid + " " + dir
+	if query.SortBy() == SortByCreated {
+		conds = append(conds, d.created+" IS NOT NULL")
+		if query.After != nil {
+			created := d.createdArg(arg(d.timeArg(query.After.Created)))
+			conds = append(conds, "("+d.created+", "+d.uid+") "+op+" ("+created+", "+arg(query.After.UID)+")")
+		}
+		order = d.created + " " + dir + ", " + order
+	} else if query.After != nil {
+		conds = append(conds, d.uid+" "+op+" "+arg(query.After.UID))
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ") + " "
+	}
+	return where + "ORDER BY " + order + " LIMIT " + arg(query.Limit), args
+}
+
+// Содержимое курсора страницы. Курсор передаётся клиенту в base64 и не должен им разбираться.
+type listCursor struct {
+	Sort       string    `json:"s"`
+	Descending bool      `json:"d,omitempty"`
+	Created    time.Time `json:"c,omitempty"`
+	UID        string    `json:"u"`
+}
+
+// Функция кодирования курсора страницы, следующей за заказом last
+func encodeListCursor(query ListQuery, last Order) string {
+	key, _ := orderListKey(last, query.SortBy())
+	data, _ := json.Marshal(listCursor{Sort: query.SortBy(), Descending: query.Descending, Created: key.Created, UID: key.UID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Функция разбора курсора страницы. Курсор действителен только для той же сортировки,
+// с которой он получен; условия отбора клиент передаёт заново с каждой страницей.
+func decodeListCursor(cursor string, query ListQuery) (*listKey, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("некорректный курсор")
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.UID == "" {
+		return nil, errors.New("некорректный курсор")
+	}
+	if c.Sort != query.SortBy() || c.Descending != query.Descending {
+		return nil, fmt.Errorf("курсор получен для сортировки %s, а не %s", c.Sort, query.SortBy())
+	}
+	return &listKey{Created: c.Created, UID: c.UID}, nil
+}
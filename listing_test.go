@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Функция создания набора заказов для проверки списка: разные покупатели, валюты и даты,
+// в том числе совпадающие даты и дата в другом часовом поясе
+func listingTestOrders() []Order {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var orders []Order
+	for i := 0; i < 12; i++ {
+		o := newTestOrder(fmt.Sprintf("list-%02d", i))
+		o.CustomerID = []string{"alice", "bob"}[i%2]
+		o.Payment.Currency = []string{"USD", "RUB", "EUR"}[i%3]
+		// Заказы парами имеют одинаковую дату, чтобы проверить упорядочивание по order_uid
+		o.DateCreated = base.Add(time.Duration(11-i/2) * time.Hour).Format(time.RFC3339)
+		orders = append(orders, o)
+	}
+	// Тот же момент, что и у list-00, но со смещением +03:00
+	orders[1].DateCreated = base.Add(11 * time.Hour).In(time.FixedZone("MSK", 3*3600)).Format(time.RFC3339)
+	return orders
+}
+
+// Функция чтения всех страниц списка с переходом по курсору
+func readAllPages(t *testing.T, list func(ListQuery) ([]Order, error), query ListQuery) []string {
+	t.Helper()
+	var uids []string
+	for pages := 0; pages < 100; pages++ {
+		page, err := list(query)
+		if err != nil {
+			t.Fatalf("Ошибка получения страницы: %v", err)
+		}
+		for _, o := range page {
+			uids = append(uids, o.OrderUID)
+		}
+		if len(page) < query.Limit {
+			return uids
+		}
+		if query.After, err = decodeListCursor(encodeListCursor(query, page[len(page)-1]), query); err != nil {
+			t.Fatalf("Ошибка разбора курсора: %v", err)
+		}
+	}
+	t.Fatal("Слишком много страниц")
+	return nil
+}
+
+func TestListOrders_ConsistentAcrossSources(t *testing.T) {
+	orders := listingTestOrders()
+	ctx := context.Background()
+
+	memory := newMemoryRepository()
+	sqlite, err := newSQLiteRepository(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Ошибка открытия SQLite: %v", err)
+	}
+	defer sqlite.Close()
+	for _, o := range orders {
+		memory.Save(ctx, o, DuplicateIgnore)
+		if _, err := sqlite.Save(ctx, o, DuplicateIgnore); err != nil {
+			t.Fatalf("Ошибка сохранения в SQLite: %v", err)
+		}
+	}
+	sources := map[string]func(ListQuery) ([]Order, error){
+		"memory": func(q ListQuery) ([]Order, error) { return memory.List(ctx, q) },
+		"sqlite": func(q ListQuery) ([]Order, error) { return sqlite.List(ctx, q) },
+		"cache":  func(q ListQuery) ([]Order, error) { return selectOrderPage(orders, q), nil },
+	}
+
+	from := time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name  string
+		query ListQuery
+		want  string
+	}{
+		{"по order_uid", ListQuery{Limit: 5},
+			"list-00,list-01,list-02,list-03,list-04,list-05,list-06,list-07,list-08,list-09,list-10,list-11"},
+		{"по order_uid по убыванию", ListQuery{Descending: true, Limit: 4},
+			"list-11,list-10,list-09,list-08,list-07,list-06,list-05,list-04,list-03,list-02,list-01,list-00"},
+		{"по дате", ListQuery{Sort: SortByCreated, Limit: 3},
+			"list-10,list-11,list-08,list-09,list-06,list-07,list-04,list-05,list-02,list-03,list-00,list-01"},
+		{"по дате по убыванию", ListQuery{Sort: SortByCreated, Descending: true, Limit: 5},
+			"list-01,list-00,list-03,list-02,list-05,list-04,list-07,list-06,list-09,list-08,list-11,list-10"},
+		{"покупатель и валюта", ListQuery{Filter: OrderFilter{CustomerID: "alice", Currency: "USD"}, Limit: 1},
+			"list-00,list-06"},
+		{"диапазон дат", ListQuery{Filter: OrderFilter{CreatedFrom: from, CreatedTo: from.Add(4 * time.Hour)}, Sort: SortByCreated, Limit: 2},
+			"list-10,list-11,list-08,list-09,list-06,list-07"},
+		{"трек-номер и транзакция", ListQuery{Filter: OrderFilter{TrackNumber: "WBILMTESTTRACK", Transaction: "list-03"}, Limit: 2},
+			"list-03"},
+	}
+	for _, c := range cases {
+		for name, list := range sources {
+			if got := strings.Join(readAllPages(t, list, c.query), ","); got != c.want {
+				t.Errorf("%s, источник %s: ожидалось %s, получено %s", c.name, name, c.want, got)
+			}
+		}
+	}
+}
+
+func TestListOrders_ByteOrderAcrossSources(t *testing.T) {
+	// Регистр и знаки препинания упорядочиваются по байтам, а не по правилам локали
+	uids := []string{"b-1", "B_2", "a.3", "A-4", "_x", "~z", "a", "a-b", "aB", "Ab", "0-9", "a_b"}
+	want := append([]string(nil), uids...)
+	sort.Strings(want)
+	reversed := make([]string, len(want))
+	for i, uid := range want {
+		reversed[len(want)-1-i] = uid
+	}
+
+	ctx := context.Background()
+	memory := newMemoryRepository()
+	sqlite, err := newSQLiteRepository(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Ошибка открытия SQLite: %v", err)
+	}
+	defer sqlite.Close()
+	var orders []Order
+	for _, uid := range uids {
+		o := newTestOrder(uid)
+		orders = append(orders, o)
+		memory.Save(ctx, o, DuplicateIgnore)
+		if _, err := sqlite.Save(ctx, o, DuplicateIgnore); err != nil {
+			t.Fatalf("Ошибка сохранения в SQLite: %v", err)
+		}
+	}
+	sources := map[string]func(ListQuery) ([]Order, error){
+		"memory": func(q ListQuery) ([]Order, error) { return memory.List(ctx, q) },
+		"sqlite": func(q ListQuery) ([]Order, error) { return sqlite.List(ctx, q) },
+		"cache":  func(q ListQuery) ([]Order, error) { return selectOrderPage(orders, q), nil },
+	}
+
+	// У всех заказов одна дата, поэтому при сортировке по дате порядок задаёт order_uid
+	for _, c := range []struct {
+		name  string
+		query ListQuery
+		want  []string
+	}{
+		{"по order_uid", ListQuery{Limit: 5}, want},
+		{"по order_uid по убыванию", ListQuery{Descending: true, Limit: 5}, reversed},
+		{"по дате", ListQuery{Sort: SortByCreated, Limit: 5}, want},
+	} {
+		for name, list := range sources {
+			if got := readAllPages(t, list, c.query); strings.Join(got, " ") != strings.Join(c.want, " ") {
+				t.Errorf("%s, источник %s: ожидалось %v, получено %v", c.name, name, c.want, got)
+			}
+		}
+	}
+
+	// Потоковое чтение хранилищ идёт в том же порядке
+	for name, r := range map[string]OrderRepository{"memory": memory, "sqlite": sqlite} {
+		var got []string
+		r.Stream(ctx, 5, func(batch OrderBatch) error {
+			for _, o := range batch.Orders {
+				got = append(got, o.OrderUID)
+			}
+			return nil
+		})
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("Stream, источник %s: ожидалось %v, получено %v", name, want, got)
+		}
+	}
+}
+
+func TestBuildListQuery_Postgres(t *testing.T) {
+	query := ListQuery{
+		Filter:     OrderFilter{CustomerID: "alice", Provider: "wbpay"},
+		Sort:       SortByCreated,
+		Descending: true,
+		After:      &listKey{Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), UID: "b"},
+		Limit:      10,
+	}
+	where, args := buildListQuery(query, postgresListDialect)
+	want := "WHERE o.customer_id = $1 AND p.provider = $2 AND orders_created_at(o.date_created) IS NOT NULL AND " +
+		`(orders_created_at(o.date_created), o.order_uid COLLATE "C") < ($3::timestamptz, $4) ` +
+		`ORDER BY orders_created_at(o.date_created) DESC, o.order_uid COLLATE "C" DESC LIMIT $5`
+	if where != want || len(args) != 5 {
+		t.Errorf("Неверный запрос:\n%s\nожидался:\n%s\nпараметры: %v", where, want, args)
+	}
+}
+
+func TestDecodeListCursor(t *testing.T) {
+	query := ListQuery{Sort: SortByCreated}
+	cursor := encodeListCursor(query, newTestOrder("cursor"))
+	key, err := decodeListCursor(cursor, query)
+	if err != nil || key.UID != "cursor" || key.Created.IsZero() {
+		t.Errorf("Курсор разобран неверно: %+v, ошибка %v", key, err)
+	}
+	if _, err := decodeListCursor(cursor, ListQuery{}); err == nil {
+		t.Error("Курсор другой сортировки должен отклоняться")
+	}
+	for _, bad := range []string{"***", "bm90IGpzb24"} {
+		if _, err := decodeListCursor(bad, query); err == nil {
+			t.Errorf("Курсор %q должен отклоняться", bad)
+		}
+	}
+}
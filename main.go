@@ -2,274 +2,372 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
-
-	"github.com/jackc/pgx/v4"
-	"github.com/nats-io/stan.go"
 )
 
-// Переменная для хранения соединения с базой данных
-var db *pgx.Conn
-
-// Мьютекс для обеспечения безопасности работы с базой данных
-var dbMutex sync.Mutex
-
-// Мьютекс для безопасной работы с кешем заказов
-var cacheMutex sync.RWMutex
-
 // Структура для представления данных о заказе
 type Order struct {
-	OrderUID    string `json:"order_uid"`
-	TrackNumber string `json:"track_number"`
-	Entry       string `json:"entry"`
-	Delivery    struct {
-		Name    string `json:"name"`
-		Phone   string `json:"phone"`
-		Zip     string `json:"zip"`
-		City    string `json:"city"`
-		Address string `json:"address"`
-		Region  string `json:"region"`
-		Email   string `json:"email"`
-	} `json:"delivery"`
-	Payment struct {
-		Transaction  string  `json:"transaction"`
-		RequestID    string  `json:"request_id"`
-		Currency     string  `json:"currency"`
-		Provider     string  `json:"provider"`
-		Amount       float64 `json:"amount"`
-		PaymentDT    int64   `json:"payment_dt"`
-		Bank         string  `json:"bank"`
-		DeliveryCost float64 `json:"delivery_cost"`
-		GoodsTotal   float64 `json:"goods_total"`
-		CustomFee    float64 `json:"custom_fee"`
-	} `json:"payment"`
-	Items []struct {
-		ChrtID      int     `json:"chrt_id"`
-		TrackNumber string  `json:"track_number"`
-		Price       float64 `json:"price"`
-		RID         string  `json:"rid"`
-		Name        string  `json:"name"`
-		Sale        int     `json:"sale"`
-		Size        string  `json:"size"`
-		TotalPrice  float64 `json:"total_price"`
-		NmID        int     `json:"nm_id"`
-		Brand       string  `json:"brand"`
-		Status      int     `json:"status"`
-	} `json:"items"`
-	Locale            string `json:"locale"`
-	InternalSignature string `json:"internal_signature"`
-	CustomerID        string `json:"customer_id"`
-	DeliveryService   string `json:"delivery_service"`
-	ShardKey          string `json:"shardkey"`
-	SmID              int    `json:"sm_id"`
-	DateCreated       string `json:"date_created"`
-	OOFShard          string `json:"oof_shard"`
+	OrderUID          string   `json:"order_uid"`
+	TrackNumber       string   `json:"track_number"`
+	Entry             string   `json:"entry"`
+	Delivery          Delivery `json:"delivery"`
+	Payment           Payment  `json:"payment"`
+	Items             []Item   `json:"items"`
+	Locale            string   `json:"locale"`
+	InternalSignature string   `json:"internal_signature"`
+	CustomerID        string   `json:"customer_id"`
+	DeliveryService   string   `json:"delivery_service"`
+	ShardKey          string   `json:"shardkey"`
+	SmID              int      `json:"sm_id"`
+	DateCreated       string   `json:"date_created"`
+	OOFShard          string   `json:"oof_shard"`
 }
 
-// Кеш для хранения заказов в памяти
-var orderCache = make(map[string]Order)
+// Структура для представления данных о доставке заказа
+type Delivery struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Zip     string `json:"zip"`
+	City    string `json:"city"`
+	Address string `json:"address"`
+	Region  string `json:"region"`
+	Email   string `json:"email"`
+}
 
-// Константы для подключения к NATS
-const (
-	natsURL     = "nats://localhost:4222"
-	clusterID   = "test-cluster"
-	clientID    = "your_client_id_2"
-	subject     = "your_subject"
-	durableName = "durable-order-sub"
-	dbUser      = "Admin_Gena"
-	dbPassword  = "pass"
-	dbName      = "orders_db"
-	dbPort      = 5433
-)
+// Структура для представления данных об оплате заказа
+type Payment struct {
+	Transaction  string  `json:"transaction"`
+	RequestID    string  `json:"request_id"`
+	Currency     string  `json:"currency"`
+	Provider     string  `json:"provider"`
+	Amount       float64 `json:"amount"`
+	PaymentDT    int64   `json:"payment_dt"`
+	Bank         string  `json:"bank"`
+	DeliveryCost float64 `json:"delivery_cost"`
+	GoodsTotal   float64 `json:"goods_total"`
+	CustomFee    float64 `json:"custom_fee"`
+}
+
+// Структура для представления товара в заказе
+type Item struct {
+	ChrtID      int     `json:"chrt_id"`
+	TrackNumber string  `json:"track_number"`
+	Price       float64 `json:"price"`
+	RID         string  `json:"rid"`
+	Name        string  `json:"name"`
+	Sale        int     `json:"sale"`
+	Size        string  `json:"size"`
+	TotalPrice  float64 `json:"total_price"`
+	NmID        int     `json:"nm_id"`
+	Brand       string  `json:"brand"`
+	Status      int     `json:"status"`
+}
 
 // Основная функция приложения
 func main() {
-	// Подключение к базе данных
-	if err := connectToDB(); err != nil {
-		log.Fatalf("Ошибка подключения к базе данных: %v", err)
+	// Подкоманда управления миграциями схемы базы данных
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(os.Args[2:]); err != nil {
+			log.Fatalf("Ошибка выполнения миграций: %v", err)
+		}
+		return
 	}
-	defer db.Close(context.Background())
 
-	// Восстановление данных из базы в кеш
-	restoreCacheFromDB()
-	// Запуск подписки на сообщения от NATS
-	go subscribeToNATS()
-	// Запуск функции отправки данных в отдельной горутине
-	go sender()
-	// Обработчик запросов по пути "/order"
-	http.HandleFunc("/order", getOrderHandler)
-	// Запуск HTTP-сервера
-	go startHTTPServer()
+	// Подкоманда сверки кеша работающего сервиса с хранилищем
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		if err := runVerifyCommand(os.Args[2:]); err != nil {
+			log.Fatalf("Ошибка сверки кеша: %v", err)
+		}
+		return
+	}
 
-	// Ожидание завершения работы приложения (Ctrl+C)
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+	os.Exit(run())
 }
 
-// Функция подключения к базе данных
-func connectToDB() error {
-	connStr := fmt.Sprintf("user=%s password=%s dbname=%s sslmode=disable port=%d", dbUser, dbPassword, dbName, dbPort)
-	var err error
-	db, err = pgx.Connect(context.Background(), connStr)
-
-	return err
-}
+// Коды завершения процесса
+const (
+	exitOK      = 0 // Остановка по сигналу, вся обработка завершена
+	exitFailure = 1 // Ошибка запуска или отказ одного из компонентов
+	exitTimeout = 2 // Обработка не завершилась за shutdown.timeout
+)
 
-// Функция восстановления данных из базы в кеш
-func restoreCacheFromDB() {
-	rows, err := db.Query(context.Background(), "SELECT order_uid, track_number FROM orders")
+// Функция запуска сервиса и ожидания остановки.
+// По SIGINT/SIGTERM или при отказе компонента сервис прекращает приём сообщений, дожидается
+// фиксации начатых сохранений и завершения HTTP-запросов и возвращает код завершения.
+func run() int {
+	// Загрузка конфигурации
+	cfg, _, err := loadConfig(os.Args[1:])
 	if err != nil {
-		log.Printf("Ошибка запроса заказов из PostgreSQL: %v", err)
-		return
+		log.Printf("Ошибка загрузки конфигурации: %v", err)
+		return exitFailure
 	}
-	defer rows.Close()
+	appConfig.Store(cfg)
+	go watchConfigReload(os.Args[1:])
 
-	for rows.Next() {
-		var order Order
-		if err := rows.Scan(&order.OrderUID, &order.TrackNumber); err != nil {
-			log.Printf("Ошибка сканирования строки: %v", err)
-			continue
-		}
-		orderCache[order.OrderUID] = order
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	orderCache = newOrderCache(cfg.Cache)
+
+	// Подключение к хранилищу заказов
+	repo, err = openRepository(ctx, cfg)
+	if err != nil {
+		log.Printf("Ошибка подключения к хранилищу заказов: %v", err)
+		return exitFailure
 	}
-}
+	defer repo.Close()
+	deadLetters = openDeadLetterStore(repo)
 
-// Функция подписки на сообщения от NATS
-func subscribeToNATS() {
-	sc, err := stan.Connect(clusterID, clientID)
+	// Подключение к NATS; транспорт (NATS Streaming или JetStream) выбирается параметром nats.transport
+	consumer, err := newOrderConsumer(cfg.NATS)
 	if err != nil {
-		log.Fatalf("Ошибка подключения к NATS: %v", err)
+		log.Printf("Ошибка подключения к NATS: %v", err)
+		return exitFailure
 	}
-	defer sc.Close()
 
-	subscription, err := sc.Subscribe(subject, func(msg *stan.Msg) {
-		var orderData Order
-		if err := json.Unmarshal(msg.Data, &orderData); err != nil {
-			log.Printf("Ошибка десериализации данных заказа: %v", err)
-			return
-		}
+	// Заполнение кеша из снимка, а если его нет или он повреждён - из базы данных
+	warmCache(ctx, consumer)
 
-		// Проверка валидности JSON
-		if !json.Valid(msg.Data) {
-			log.Printf("Получен невалидный JSON: %s", msg.Data)
-			return
+	// Запуск подписки на сообщения от NATS
+	in, err := startIngestion(cfg.NATS, consumer)
+	if err != nil {
+		log.Printf("Ошибка подключения к NATS: %v", err)
+		return exitFailure
+	}
+	// Периодическая запись снимка кеша
+	snapshotsDone := make(chan struct{})
+	go func() {
+		defer close(snapshotsDone)
+		if cfg.Snapshot.Path != "" {
+			runSnapshots(ctx)
+		}
+	}()
+	// Запуск функции отправки данных в отдельной горутине
+	senderDone := make(chan struct{})
+	go func() {
+		defer close(senderDone)
+		sender(ctx)
+	}()
+
+	// Обработчики REST API заказов и прежнего адреса "/order"
+	registerAPIHandlers(http.DefaultServeMux)
+	// Веб-интерфейс поиска заказов
+	registerWebUIHandlers(http.DefaultServeMux)
+	// Обработчики управления отклонёнными сообщениями, статистики, восстановления и сверки кеша
+	registerDeadLetterHandlers(http.DefaultServeMux)
+	http.HandleFunc("GET /admin/cache", cacheStatsHandler)
+	http.HandleFunc("GET /admin/recovery", recoveryReportHandler)
+	http.HandleFunc("GET /admin/verify", verifyCacheHandler(false))
+	http.HandleFunc("POST /admin/verify/repair", verifyCacheHandler(true))
+	// Запуск HTTP-сервера
+	server := newHTTPServer(cfg.HTTP, http.DefaultServeMux)
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
 		}
+	}()
+
+	// Ожидание сигнала остановки (Ctrl+C) или отказа HTTP-сервера
+	code := exitOK
+	select {
+	case <-ctx.Done():
+		log.Println("Получен сигнал остановки, завершаем обработку")
+	case err := <-serverErr:
+		log.Printf("Ошибка HTTP-сервера: %v", err)
+		code = exitFailure
+	}
+	stop()
 
-		// Сохранение данных в базе данных и кэше
-		saveOrder(orderData)
-		updateOrderCache(orderData)
-	}, stan.DurableName(durableName))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), currentConfig().Shutdown.Timeout)
+	defer cancel()
 
-	if err != nil {
-		log.Fatalf("Ошибка установки подписки на NATS: %v", err)
+	// Сначала прекращается приём сообщений, затем HTTP-запросы, чтобы ответы
+	// до последнего момента отражали заказы, сохранённые при остановке
+	if err := in.Stop(shutdownCtx); err != nil {
+		log.Printf("Ошибка остановки приёма заказов: %v", err)
+		code = shutdownExitCode(code, err)
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Ошибка остановки HTTP-сервера: %v", err)
+		code = shutdownExitCode(code, err)
+	}
+	// Последний снимок пишется после остановки приёма, чтобы он включал все подтверждённые сообщения
+	<-snapshotsDone
+	if cfg.Snapshot.Path != "" {
+		saveSnapshot(currentConfig())
+	}
+	select {
+	case <-senderDone:
+	case <-shutdownCtx.Done():
+		log.Println("Генератор тестовых заказов не остановился вовремя")
+		code = shutdownExitCode(code, shutdownCtx.Err())
 	}
-	defer subscription.Unsubscribe()
 
-	// Бесконечный цикл для поддержания подписки
-	select {}
+	log.Printf("Сервис остановлен, код завершения %d", code)
+	return code
 }
 
-// Функция обновления кеша заказов
-func updateOrderCache(order Order) {
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
-	orderCache[order.OrderUID] = order
+// Функция выбора кода завершения с учётом ошибки остановки.
+// Уже зафиксированный отказ компонента не заменяется.
+func shutdownExitCode(code int, err error) int {
+	if code != exitOK {
+		return code
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return exitTimeout
+	}
+	return exitFailure
 }
 
-// Функция сохранения данных заказа в базу данных
-func saveOrder(order Order) {
-	// Заблокировать мьютекс перед началом транзакции
-	dbMutex.Lock()
-	defer dbMutex.Unlock()
+// Функция начального заполнения кеша. Если снимок включён и прочитан, кеш заполняется из него
+// и из сообщений, пришедших после снимка; иначе кеш восстанавливается из источника restore.source,
+// а при ошибке чтения канала - из базы данных.
+func warmCache(ctx context.Context, consumer OrderConsumer) {
+	if currentConfig().Snapshot.Path != "" {
+		stats, err := warmStartFromSnapshot(ctx, consumer)
+		if err == nil {
+			log.Printf("Кеш загружен из снимка: заказов %d, сообщение %d, прочитано сообщений после снимка %d, обновлено заказов %d",
+				stats.Loaded, stats.Sequence, stats.Replayed, stats.Refreshed)
+			return
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("Снимок кеша не найден, кеш будет восстановлен из базы данных")
+		} else {
+			log.Printf("Снимок кеша не использован: %v", err)
+		}
+	}
 
-	// Начать транзакцию
-	tx, err := db.Begin(context.Background())
-	if err != nil {
-		log.Printf("Ошибка начала транзакции: %v", err)
-		return
+	// Восстановление кеша повторным чтением канала со сверкой с хранилищем
+	if currentConfig().Restore.Source == RestoreFromReplay {
+		report, err := restoreCacheFromReplay(ctx, consumer)
+		if err == nil {
+			logRecoveryReport(report)
+			return
+		}
+		log.Printf("Ошибка восстановления кеша из канала, кеш будет восстановлен из базы данных: %v", err)
+		orderCache = newOrderCache(currentConfig().Cache)
 	}
 
-	// Вставка данных в таблицу orders
-	_, err = tx.Exec(context.Background(), "INSERT INTO orders VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
-		order.OrderUID, order.TrackNumber, order.Entry, order.DeliveryService, order.Locale,
-		order.InternalSignature, order.CustomerID, order.ShardKey, order.SmID, order.DateCreated, order.OOFShard)
-	if err != nil {
-		log.Printf("Ошибка сохранения заказа в PostgreSQL: %v", err)
-		tx.Rollback(context.Background()) // Откатить транзакцию при ошибке
-		return
+	// Номер последнего сообщения определяется до чтения базы: подтверждённые сообщения до него
+	// уже в хранилище, а неподтверждённые доставит durable-подписка. Без него снимок,
+	// записанный до первого полученного сообщения, заставил бы перечитывать весь канал.
+	last, lastErr := consumer.LastSequence(ctx)
+	if lastErr != nil {
+		log.Printf("Не удалось определить последнее сообщение канала: %v", lastErr)
 	}
 
-	// Вставка данных в таблицу delivery
-	_, err = tx.Exec(context.Background(), "INSERT INTO delivery VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
-		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City,
-		order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+	// Восстановление данных из базы в кеш
+	stats, err := restoreCacheFromDB(ctx)
 	if err != nil {
-		log.Printf("Ошибка сохранения информации о доставке в PostgreSQL: %v", err)
-		tx.Rollback(context.Background()) // Откатить транзакцию при ошибке
-		return
+		log.Printf("Ошибка восстановления кеша из базы данных: %v", err)
+	} else if lastErr == nil {
+		markSequenceApplied(last)
 	}
+	log.Printf("Кеш восстановлен: заказов %d, ошибок %d, пачек %d", stats.Loaded, stats.Failed, stats.Batches)
+}
 
-	// Вставка данных в таблицу payment
-	_, err = tx.Exec(context.Background(), "INSERT INTO payment VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
-		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
-		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDT, order.Payment.Bank,
-		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
+// Признак остановки восстановления из-за заполнения кеша
+var errCacheFull = errors.New("кеш заполнен")
 
-	if err != nil {
-		log.Printf("Ошибка сохранения информации о платеже в PostgreSQL: %v", err)
-		tx.Rollback(context.Background()) // Откатить транзакцию при ошибке
-		return
-	}
+// Статистика восстановления кеша из базы данных
+type restoreStats struct {
+	Loaded  int // Количество заказов, загруженных в кеш
+	Failed  int // Количество заказов, которые не удалось восстановить
+	Batches int // Количество обработанных пачек
+}
 
-	// Вставка данных в таблицу items
-	for _, item := range order.Items {
-		_, err := tx.Exec(context.Background(), "INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)",
-			order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name, item.Sale, item.Size,
-			item.TotalPrice, item.NmID, item.Brand, item.Status)
-		if err != nil {
-			log.Printf("Ошибка сохранения информации о товаре в PostgreSQL: %v", err)
-			tx.Rollback(context.Background()) // Откатить транзакцию при ошибке
-			return
+// Функция восстановления данных из базы в кеш.
+// Заказы читаются из хранилища пачками по restore.batch_size, каждая пачка
+// содержит полностью собранные заказы и целиком помещается в кеш.
+// Чтение прекращается, когда один из сегментов кеша заполнен до своей доли ограничений
+// cache.max_entries или cache.max_bytes, чтобы загрузка не вытесняла уже загруженные заказы:
+// остальные заказы будут загружены из хранилища при первом запросе.
+// Восстановление прерывается по истечении restore.timeout или при отмене ctx,
+// заказы из уже прочитанных пачек при этом остаются в кеше.
+func restoreCacheFromDB(ctx context.Context) (restoreStats, error) {
+	cfg := currentConfig().Restore
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	var stats restoreStats
+	err := repo.Stream(ctx, cfg.BatchSize, func(batch OrderBatch) error {
+		stats.Batches++
+		stats.Failed += batch.Failed
+
+		full := false
+		for _, order := range batch.Orders {
+			if full = orderCache.Full(); full {
+				break
+			}
+			orderCache.Set(order)
+			stats.Loaded++
 		}
-	}
 
-	// Подтвердить транзакцию, если все операции успешны
-	err = tx.Commit(context.Background())
-	if err != nil {
-		log.Printf("Ошибка подтверждения транзакции: %v", err)
-		tx.Rollback(context.Background()) // Откатить транзакцию при ошибке
-		return
+		log.Printf("Восстановление кеша: пачка %d, загружено заказов %d, ошибок %d", stats.Batches, stats.Loaded, stats.Failed)
+		if full || orderCache.Full() {
+			return errCacheFull
+		}
+		return nil
+	})
+	if errors.Is(err, errCacheFull) {
+		log.Printf("Кеш заполнен, восстановление остановлено")
+		err = nil
 	}
+
+	return stats, err
 }
 
-// Обработчик HTTP-запросов для получения данных о заказе
-func getOrderHandler(w http.ResponseWriter, r *http.Request) {
-	orderID := r.URL.Query().Get("id")
+// Функция обновления кеша заказов
+func updateOrderCache(order Order) {
+	orderCache.Set(order)
+	missingOrders.remove(order.OrderUID)
+}
 
-	// Заблокировать мьютекс для чтения из кеша
-	cacheMutex.RLock()
-	order, ok := orderCache[orderID]
-	cacheMutex.RUnlock()
+// Функция сохранения данных заказа в хранилище.
+// Кеш обновляется только после успешной фиксации транзакции и только если данные заказа
+// в хранилище изменились, поэтому кеш и база не расходятся при повторной доставке.
+func saveOrder(ctx context.Context, order Order) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
 
-	if !ok {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte("Заказ не найден"))
-		return
+	policy := currentConfig().Ingest.DuplicatePolicy
+	result, err := repo.Save(ctx, order, policy)
+	if err != nil {
+		return err
 	}
 
-	// Отправить данные заказа в ответ на HTTP-запрос
-	json.NewEncoder(w).Encode(order)
+	switch result {
+	case SaveUnchanged:
+		log.Printf("Повторный заказ %s пропущен (политика %s)", order.OrderUID, policy)
+	case SaveReplaced:
+		log.Printf("Заказ %s заменён новыми данными", order.OrderUID)
+		updateOrderCache(order)
+	default:
+		updateOrderCache(order)
+	}
+	return nil
 }
 
-// Запуск HTTP-сервера
-func startHTTPServer() {
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// Обработчик HTTP-запросов для получения данных о заказе по параметру id.
+// Прежний адрес /order?id= сохранён для совместимости, ответ тот же, что у /api/v1/orders/{uid}.
+func getOrderHandler(w http.ResponseWriter, r *http.Request) {
+	serveOrder(w, r, r.URL.Query().Get("id"))
+}
+
+// Функция создания HTTP-сервера с ограничениями времени из конфигурации
+func newHTTPServer(cfg HTTPConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
 }
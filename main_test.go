@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestGetOrderHandler(t *testing.T) {
@@ -14,15 +20,7 @@ func TestGetOrderHandler(t *testing.T) {
 		OrderUID:    "fakeOrderID",
 		TrackNumber: "123456789",
 		Entry:       "Entry1",
-		Delivery: struct {
-			Name    string `json:"name"`
-			Phone   string `json:"phone"`
-			Zip     string `json:"zip"`
-			City    string `json:"city"`
-			Address string `json:"address"`
-			Region  string `json:"region"`
-			Email   string `json:"email"`
-		}{
+		Delivery: Delivery{
 			Name:    "John Doe",
 			Phone:   "1234567890",
 			Zip:     "12345",
@@ -31,18 +29,7 @@ func TestGetOrderHandler(t *testing.T) {
 			Region:  "Region1",
 			Email:   "john.doe@example.com",
 		},
-		Payment: struct {
-			Transaction  string  `json:"transaction"`
-			RequestID    string  `json:"request_id"`
-			Currency     string  `json:"currency"`
-			Provider     string  `json:"provider"`
-			Amount       float64 `json:"amount"`
-			PaymentDT    int64   `json:"payment_dt"`
-			Bank         string  `json:"bank"`
-			DeliveryCost float64 `json:"delivery_cost"`
-			GoodsTotal   float64 `json:"goods_total"`
-			CustomFee    float64 `json:"custom_fee"`
-		}{
+		Payment: Payment{
 			Transaction:  "trans123",
 			RequestID:    "req123",
 			Currency:     "USD",
@@ -54,19 +41,7 @@ func TestGetOrderHandler(t *testing.T) {
 			GoodsTotal:   90.00,
 			CustomFee:    5.00,
 		},
-		Items: []struct {
-			ChrtID      int     `json:"chrt_id"`
-			TrackNumber string  `json:"track_number"`
-			Price       float64 `json:"price"`
-			RID         string  `json:"rid"`
-			Name        string  `json:"name"`
-			Sale        int     `json:"sale"`
-			Size        string  `json:"size"`
-			TotalPrice  float64 `json:"total_price"`
-			NmID        int     `json:"nm_id"`
-			Brand       string  `json:"brand"`
-			Status      int     `json:"status"`
-		}{
+		Items: []Item{
 			{
 				ChrtID:      1,
 				TrackNumber: "item123",
@@ -92,9 +67,7 @@ func TestGetOrderHandler(t *testing.T) {
 	}
 
 	// Добавляем фейковый заказ в кеш
-	cacheMutex.Lock()
-	orderCache[fakeOrderID] = fakeOrder
-	cacheMutex.Unlock()
+	orderCache.Set(fakeOrder)
 
 	// Создаем HTTP-запрос с параметром id=fakeOrderID
 	req, err := http.NewRequest("GET", "/order?id="+fakeOrderID, nil)
@@ -126,12 +99,12 @@ func TestGetOrderHandler(t *testing.T) {
 	}
 
 	// Очищаем фейковый заказ из кеша
-	cacheMutex.Lock()
-	delete(orderCache, fakeOrderID)
-	cacheMutex.Unlock()
+	orderCache.Delete(fakeOrderID)
 }
 
 func TestGetOrderHandler_OrderNotFound(t *testing.T) {
+	useTestRepository(t, newMemoryRepository())
+
 	// Создаем HTTP-запрос с параметром id=nonexistentOrderID
 	req, err := http.NewRequest("GET", "/order?id=nonexistentOrderID", nil)
 	if err != nil {
@@ -149,14 +122,13 @@ func TestGetOrderHandler_OrderNotFound(t *testing.T) {
 		t.Errorf("Ожидался код состояния %d, получено: %d", http.StatusNotFound, recorder.Code)
 	}
 
-	// Проверяем текст ответа
-	expectedBody := "Заказ не найден"
-	if body := recorder.Body.String(); body != expectedBody {
-		t.Errorf("Ожидался текст %s, получено: %s", expectedBody, body)
-	}
+	// Проверяем ошибку в ответе
+	expectAPIError(t, recorder, errCodeOrderNotFound)
 }
 
 func TestGetOrderHandler_InvalidID(t *testing.T) {
+	useTestRepository(t, newMemoryRepository())
+
 	// Создаем HTTP-запрос с параметром id=invalidOrderID (некорректный формат ID)
 	req, err := http.NewRequest("GET", "/order?id=invalidOrderID", nil)
 	if err != nil {
@@ -174,11 +146,8 @@ func TestGetOrderHandler_InvalidID(t *testing.T) {
 		t.Errorf("Ожидался код состояния %d, получено: %d", http.StatusNotFound, recorder.Code)
 	}
 
-	// Проверяем текст ответа
-	expectedBody := "Заказ не найден"
-	if body := recorder.Body.String(); body != expectedBody {
-		t.Errorf("Ожидался текст %s, получено: %s", expectedBody, body)
-	}
+	// Проверяем ошибку в ответе
+	expectAPIError(t, recorder, errCodeOrderNotFound)
 }
 
 func TestHTTPServer(t *testing.T) {
@@ -188,15 +157,7 @@ func TestHTTPServer(t *testing.T) {
 		OrderUID:    "fakeOrderID",
 		TrackNumber: "123456789",
 		Entry:       "Entry1",
-		Delivery: struct {
-			Name    string `json:"name"`
-			Phone   string `json:"phone"`
-			Zip     string `json:"zip"`
-			City    string `json:"city"`
-			Address string `json:"address"`
-			Region  string `json:"region"`
-			Email   string `json:"email"`
-		}{
+		Delivery: Delivery{
 			Name:    "John Doe",
 			Phone:   "1234567890",
 			Zip:     "12345",
@@ -205,18 +166,7 @@ func TestHTTPServer(t *testing.T) {
 			Region:  "Region1",
 			Email:   "john.doe@example.com",
 		},
-		Payment: struct {
-			Transaction  string  `json:"transaction"`
-			RequestID    string  `json:"request_id"`
-			Currency     string  `json:"currency"`
-			Provider     string  `json:"provider"`
-			Amount       float64 `json:"amount"`
-			PaymentDT    int64   `json:"payment_dt"`
-			Bank         string  `json:"bank"`
-			DeliveryCost float64 `json:"delivery_cost"`
-			GoodsTotal   float64 `json:"goods_total"`
-			CustomFee    float64 `json:"custom_fee"`
-		}{
+		Payment: Payment{
 			Transaction:  "trans123",
 			RequestID:    "req123",
 			Currency:     "USD",
@@ -228,19 +178,7 @@ func TestHTTPServer(t *testing.T) {
 			GoodsTotal:   90.00,
 			CustomFee:    5.00,
 		},
-		Items: []struct {
-			ChrtID      int     `json:"chrt_id"`
-			TrackNumber string  `json:"track_number"`
-			Price       float64 `json:"price"`
-			RID         string  `json:"rid"`
-			Name        string  `json:"name"`
-			Sale        int     `json:"sale"`
-			Size        string  `json:"size"`
-			TotalPrice  float64 `json:"total_price"`
-			NmID        int     `json:"nm_id"`
-			Brand       string  `json:"brand"`
-			Status      int     `json:"status"`
-		}{
+		Items: []Item{
 			{
 				ChrtID:      1,
 				TrackNumber: "item123",
@@ -267,9 +205,7 @@ func TestHTTPServer(t *testing.T) {
 	}
 
 	// Добавляем фейковый заказ в кеш
-	cacheMutex.Lock()
-	orderCache[fakeOrderID] = fakeOrder
-	cacheMutex.Unlock()
+	orderCache.Set(fakeOrder)
 
 	// Создаем новый HTTP-сервер и передаем ему обработчик запросов
 	ts := httptest.NewServer(http.HandlerFunc(getOrderHandler))
@@ -300,7 +236,208 @@ func TestHTTPServer(t *testing.T) {
 	}
 
 	// Очищаем фейковый заказ из кеша
-	cacheMutex.Lock()
-	delete(orderCache, fakeOrderID)
-	cacheMutex.Unlock()
+	orderCache.Delete(fakeOrderID)
+}
+
+func TestGetOrderHandler_LoadsFromRepository(t *testing.T) {
+	memory := newMemoryRepository()
+	useTestRepository(t, memory)
+	order := newTestOrder("repository-order")
+	memory.Save(context.Background(), order, DuplicateIgnore)
+	defer orderCache.Delete(order.OrderUID)
+
+	recorder := httptest.NewRecorder()
+	getOrderHandler(recorder, httptest.NewRequest("GET", "/order?id="+order.OrderUID, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Ожидался код состояния %d, получено: %d", http.StatusOK, recorder.Code)
+	}
+
+	// Найденный в хранилище заказ попадает в кеш
+	_, cached := orderCache.Get(order.OrderUID)
+	if !cached {
+		t.Error("Заказ из хранилища не добавлен в кеш")
+	}
+}
+
+// Хранилище, операции которого завершаются только по отмене контекста
+type stalledRepository struct {
+	OrderRepository
+}
+
+func (stalledRepository) Get(ctx context.Context, uid string) (Order, error) {
+	<-ctx.Done()
+	return Order{}, ctx.Err()
+}
+
+func (stalledRepository) Save(ctx context.Context, order Order, policy DuplicatePolicy) (SaveResult, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestGetOrderHandler_StorageTimeout(t *testing.T) {
+	useTestRepository(t, stalledRepository{})
+	useTestConfig(t, func(cfg *Config) { cfg.DB.QueryTimeout = 10 * time.Millisecond })
+
+	recorder := httptest.NewRecorder()
+	getOrderHandler(recorder, httptest.NewRequest("GET", "/order?id=stalled", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Ожидался код состояния %d, получено: %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+}
+
+// Кеш на одной глобальной блокировке, как до разделения на сегменты, для сравнения в бенчмарках.
+// Заказ при записи кодируется так же, как в OrderCache.Set, чтобы сравнивались только блокировки.
+type rwMutexCache struct {
+	mu      sync.RWMutex
+	orders  map[string]Order
+	encoded map[string]*encodedOrder
+}
+
+func newRWMutexCache() *rwMutexCache {
+	return &rwMutexCache{orders: make(map[string]Order), encoded: make(map[string]*encodedOrder)}
+}
+
+func (c *rwMutexCache) Get(uid string) (Order, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	order, ok := c.orders[uid]
+	return order, ok
+}
+
+func (c *rwMutexCache) Set(order Order) {
+	encoded, err := encodeOrder(order, benchmarkGzipMinSize)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.orders[order.OrderUID] = order
+	c.encoded[order.OrderUID] = encoded
+}
+
+// Количество заказов в кеше для бенчмарков
+const benchmarkOrders = 10000
+
+// Порог сжатия для всех сравниваемых реализаций кеша
+var benchmarkGzipMinSize = defaultConfig().Cache.GzipMinSize
+
+// Значения GOMAXPROCS, при которых сравниваются реализации кеша
+var benchmarkProcs = []int{1, 4, 16}
+
+// Функция нагрузки на кеш: 90% чтений и 10% записей из множества горутин.
+// Нагрузка повторяется при нескольких значениях GOMAXPROCS: с одним потоком блокировки
+// не конкурируют, и выигрыш от сегментов виден только при нескольких потоках на машине
+// с соответствующим количеством ядер (go test -run ^$ -bench CacheMixed).
+func benchmarkCacheMixed(b *testing.B, get func(uid string) (Order, bool), set func(order Order)) {
+	orders := make([]Order, benchmarkOrders)
+	for i := range orders {
+		orders[i] = newTestOrder(fmt.Sprintf("bench-%d", i))
+		set(orders[i])
+	}
+
+	for _, procs := range benchmarkProcs {
+		b.Run(fmt.Sprintf("procs=%d", procs), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+
+			// Имитация сотен одновременных клиентов, как в замерах go-wrk
+			b.SetParallelism(64)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rnd := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					order := orders[rnd.Intn(len(orders))]
+					if rnd.Intn(10) == 0 {
+						set(order)
+					} else {
+						get(order.OrderUID)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkCacheMixed_GlobalRWMutex(b *testing.B) {
+	c := newRWMutexCache()
+	benchmarkCacheMixed(b, c.Get, c.Set)
+}
+
+func BenchmarkCacheMixed_Shards1(b *testing.B) {
+	c := newOrderCache(CacheConfig{Policy: EvictLRU, Shards: 1, GzipMinSize: benchmarkGzipMinSize})
+	benchmarkCacheMixed(b, c.Get, c.Set)
+}
+
+func BenchmarkCacheMixed_Shards32(b *testing.B) {
+	c := newOrderCache(CacheConfig{Policy: EvictLRU, Shards: 32, GzipMinSize: benchmarkGzipMinSize})
+	benchmarkCacheMixed(b, c.Get, c.Set)
+}
+
+func BenchmarkCacheMixed_Shards32LFU(b *testing.B) {
+	c := newOrderCache(CacheConfig{Policy: EvictLFU, Shards: 32, GzipMinSize: benchmarkGzipMinSize})
+	benchmarkCacheMixed(b, c.Get, c.Set)
+}
+
+func BenchmarkGetOrderHandler(b *testing.B) {
+	previous := orderCache
+	orderCache = newOrderCache(defaultConfig().Cache)
+	defer func() { orderCache = previous }()
+	order := newTestOrder("bench-handler")
+	orderCache.Set(order)
+
+	b.SetParallelism(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			recorder := httptest.NewRecorder()
+			getOrderHandler(recorder, httptest.NewRequest("GET", "/order?id="+order.OrderUID, nil))
+		}
+	})
+}
+
+func TestRestoreCacheFromDB(t *testing.T) {
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	useTestCache(t)
+	useTestConfig(t, func(cfg *Config) { cfg.Restore.BatchSize = 2 })
+	for i := 0; i < 5; i++ {
+		r.Save(context.Background(), newTestOrder(fmt.Sprintf("restore-%d", i)), DuplicateIgnore)
+	}
+
+	stats, err := restoreCacheFromDB(context.Background())
+	if err != nil {
+		t.Fatalf("Ошибка восстановления кеша: %v", err)
+	}
+	if stats.Loaded != 5 || stats.Batches != 3 || stats.Failed != 0 {
+		t.Errorf("Ожидались 5 заказов в 3 пачках без ошибок, получено: %+v", stats)
+	}
+	for i := 0; i < 5; i++ {
+		uid := fmt.Sprintf("restore-%d", i)
+		cached, ok := orderCache.Get(uid)
+		if !ok {
+			t.Errorf("Заказ %s не восстановлен в кеш", uid)
+			continue
+		}
+		if !ordersEqual(cached, newTestOrder(uid)) {
+			t.Errorf("Заказ %s в кеше отличается от хранилища: %+v", uid, cached)
+		}
+	}
+
+	// Восстановление останавливается, когда кеш заполнен
+	orderCache = newOrderCache(CacheConfig{Policy: EvictLRU, MaxEntries: 3, Shards: 1})
+	stats, err = restoreCacheFromDB(context.Background())
+	if err != nil {
+		t.Fatalf("Ошибка восстановления кеша: %v", err)
+	}
+	if stats.Batches != 2 || stats.Loaded != 3 || orderCache.Stats().Entries != 3 {
+		t.Errorf("Ожидалась остановка после 2 пачек с 3 заказами в кеше, получено: %+v, в кеше %d", stats, orderCache.Stats().Entries)
+	}
+
+	// В сегментированном кеше восстановление останавливается раньше, чем сегмент начнёт вытеснять заказы
+	orderCache = newOrderCache(CacheConfig{Policy: EvictLRU, MaxEntries: 4, Shards: 2})
+	if _, err := restoreCacheFromDB(context.Background()); err != nil {
+		t.Fatalf("Ошибка восстановления кеша: %v", err)
+	}
+	if cacheStats := orderCache.Stats(); cacheStats.Evictions != 0 {
+		t.Errorf("Восстановление вытеснило заказы из кеша: %+v", cacheStats)
+	}
 }
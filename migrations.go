@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Миграции схемы PostgreSQL, встроенные в бинарный файл.
+// Файлы называются NNNN_описание.up.sql и NNNN_описание.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Ключ advisory-блокировки, исключающей одновременное применение миграций несколькими экземплярами
+const migrationLockKey = 7262733
+
+// Соединение или пул, через которые выполняются миграции
+type migrationDB interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Описание одной версии схемы
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Функция чтения встроенных миграций, упорядоченных по версии
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base := strings.TrimSuffix(file, ".sql")
+		direction := path.Ext(base)
+		base = strings.TrimSuffix(base, direction)
+
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || (direction != ".up" && direction != ".down") {
+			return nil, fmt.Errorf("некорректное имя файла миграции %s", file)
+		}
+
+		data, err := migrationFiles.ReadFile("migrations/" + file)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == ".up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("у миграции %04d_%s должны быть файлы up и down", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("пропущена версия миграции %d", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Функция создания таблицы с историей применённых миграций
+func ensureMigrationsTable(ctx context.Context, db migrationDB) error {
+	_, err := db.Exec(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER PRIMARY KEY,
+    name       TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`)
+	return err
+}
+
+// Функция получения текущей версии схемы, 0 если миграции не применялись
+func schemaVersion(ctx context.Context, db migrationDB) (int, error) {
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return 0, fmt.Errorf("ошибка создания таблицы schema_migrations: %w", err)
+	}
+	var version int
+	err := db.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Функция выполнения fn под advisory-блокировкой миграций.
+// Блокировка берётся один раз на всё выполнение на отдельном соединении, поэтому версию схемы
+// нужно читать уже внутри fn: другой экземпляр мог применить миграции, пока мы ждали блокировку.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("ошибка получения блокировки миграций: %w", err)
+	}
+	defer func() {
+		// Контекст вызова мог быть отменён, а блокировку нужно снять в любом случае
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+			log.Printf("Ошибка снятия блокировки миграций: %v", err)
+		}
+	}()
+	return fn(conn)
+}
+
+// Функция применения миграций вплоть до версии target включительно
+func migrateUp(ctx context.Context, pool *pgxpool.Pool, target int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		current, err := schemaVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if m.Version <= current || m.Version > target {
+				continue
+			}
+			err := applyMigration(ctx, conn, m.Up, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("ошибка применения миграции %04d_%s: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Применена миграция %04d_%s", m.Version, m.Name)
+		}
+		return nil
+	})
+}
+
+// Функция отката последних steps миграций
+func migrateDown(ctx context.Context, pool *pgxpool.Pool, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(ctx, pool, func(conn *pgxpool.Conn) error {
+		current, err := schemaVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if current > len(migrations) {
+			return fmt.Errorf("версия схемы %d неизвестна этой сборке, откат невозможен", current)
+		}
+
+		for i := 0; i < steps && current > 0; i++ {
+			m := migrations[current-1]
+			err := applyMigration(ctx, conn, m.Down, func(tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("ошибка отката миграции %04d_%s: %w", m.Version, m.Name, err)
+			}
+			log.Printf("Откачена миграция %04d_%s", m.Version, m.Name)
+			current--
+		}
+		return nil
+	})
+}
+
+// Функция выполнения SQL миграции и записи в историю в одной транзакции.
+// Вызывается под блокировкой withMigrationLock.
+func applyMigration(ctx context.Context, db migrationDB, sql string, record func(tx pgx.Tx) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Функция проверки версии схемы при запуске сервиса.
+// Сервис отказывается работать со схемой новее известной ему версии,
+// а устаревшую схему обновляет только при db.auto_migrate.
+func checkSchemaVersion(ctx context.Context, pool *pgxpool.Pool, autoMigrate bool) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	latest := len(migrations)
+
+	current, err := schemaVersion(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case current > latest:
+		return fmt.Errorf("версия схемы базы %d новее поддерживаемой версии %d, обновите сервис", current, latest)
+	case current < latest && autoMigrate:
+		log.Printf("Схема базы версии %d устарела, применяем миграции до версии %d", current, latest)
+		return migrateUp(ctx, pool, latest)
+	case current < latest:
+		return fmt.Errorf("версия схемы базы %d устарела (требуется %d), выполните команду migrate up", current, latest)
+	}
+	return nil
+}
+
+// Функция выполнения подкоманды migrate.
+//
+// Использование: migrate [флаги конфигурации] up [версия] | down [шагов] | status
+func runMigrateCommand(args []string) error {
+	cfg, rest, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return errors.New("укажите действие: up [версия], down [шагов] или status")
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	r, err := newPostgresRepository(ctx, cfg.DB)
+	if err != nil {
+		return fmt.Errorf("ошибка подключения к PostgreSQL: %w", err)
+	}
+	defer r.Close()
+
+	// Необязательный числовой аргумент действия
+	number := func(def int) (int, error) {
+		if len(rest) < 2 {
+			return def, nil
+		}
+		n, err := strconv.Atoi(rest[1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("некорректное число %q", rest[1])
+		}
+		return n, nil
+	}
+
+	switch rest[0] {
+	case "up":
+		target, err := number(len(migrations))
+		if err != nil {
+			return err
+		}
+		return migrateUp(ctx, r.pool, target)
+	case "down":
+		steps, err := number(1)
+		if err != nil {
+			return err
+		}
+		return migrateDown(ctx, r.pool, steps)
+	case "status":
+		current, err := schemaVersion(ctx, r.pool)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Текущая версия схемы: %d, последняя известная: %d\n", current, len(migrations))
+		for _, m := range migrations {
+			mark := " "
+			if m.Version <= current {
+				mark = "x"
+			}
+			fmt.Fprintf(os.Stdout, "[%s] %04d_%s\n", mark, m.Version, m.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("неизвестное действие %q", rest[0])
+	}
+}
@@ -0,0 +1,60 @@
+-- Исходная схема хранения заказов.
+-- IF NOT EXISTS позволяет принять под управление миграций базы,
+-- в которых таблицы были созданы вручную до появления миграций.
+
+CREATE TABLE IF NOT EXISTS orders (
+    order_uid          TEXT PRIMARY KEY,
+    track_number       TEXT NOT NULL,
+    entry              TEXT NOT NULL,
+    delivery_service   TEXT NOT NULL,
+    locale             TEXT NOT NULL,
+    internal_signature TEXT NOT NULL,
+    customer_id        TEXT NOT NULL,
+    shardkey           TEXT NOT NULL,
+    sm_id              INTEGER NOT NULL,
+    date_created       TEXT NOT NULL,
+    oof_shard          TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS delivery (
+    order_uid TEXT PRIMARY KEY REFERENCES orders (order_uid) ON DELETE CASCADE,
+    name      TEXT NOT NULL,
+    phone     TEXT NOT NULL,
+    zip       TEXT NOT NULL,
+    city      TEXT NOT NULL,
+    address   TEXT NOT NULL,
+    region    TEXT NOT NULL,
+    email     TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS payment (
+    order_uid     TEXT PRIMARY KEY REFERENCES orders (order_uid) ON DELETE CASCADE,
+    transaction   TEXT NOT NULL,
+    request_id    TEXT NOT NULL,
+    currency      TEXT NOT NULL,
+    provider      TEXT NOT NULL,
+    amount        DOUBLE PRECISION NOT NULL,
+    payment_dt    BIGINT NOT NULL,
+    bank          TEXT NOT NULL,
+    delivery_cost DOUBLE PRECISION NOT NULL,
+    goods_total   DOUBLE PRECISION NOT NULL,
+    custom_fee    DOUBLE PRECISION NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS items (
+    id           BIGSERIAL PRIMARY KEY,
+    order_uid    TEXT NOT NULL REFERENCES orders (order_uid) ON DELETE CASCADE,
+    chrt_id      BIGINT NOT NULL,
+    track_number TEXT NOT NULL,
+    price        DOUBLE PRECISION NOT NULL,
+    rid          TEXT NOT NULL,
+    name         TEXT NOT NULL,
+    sale         INTEGER NOT NULL,
+    size         TEXT NOT NULL,
+    total_price  DOUBLE PRECISION NOT NULL,
+    nm_id        BIGINT NOT NULL,
+    brand        TEXT NOT NULL,
+    status       INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS items_order_uid_idx ON items (order_uid);
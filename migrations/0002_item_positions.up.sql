@@ -0,0 +1,15 @@
+-- Позиция товара внутри заказа служит естественным ключом строки items
+-- и позволяет обновлять товары через ON CONFLICT при повторной доставке заказа.
+
+ALTER TABLE items ADD COLUMN position INTEGER;
+
+UPDATE items i
+SET position = numbered.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY order_uid ORDER BY id) - 1 AS position
+    FROM items
+) numbered
+WHERE numbered.id = i.id;
+
+ALTER TABLE items ALTER COLUMN position SET NOT NULL;
+ALTER TABLE items ADD CONSTRAINT items_order_uid_position_key UNIQUE (order_uid, position);
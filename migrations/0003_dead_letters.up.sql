@@ -0,0 +1,10 @@
+-- Сообщения, которые не удалось обработать, с исходными данными для повторной обработки
+CREATE TABLE dead_letters (
+    id         BIGSERIAL PRIMARY KEY,
+    subject    TEXT NOT NULL,
+    sequence   BIGINT NOT NULL,
+    payload    BYTEA NOT NULL,
+    error      TEXT NOT NULL,
+    attempts   INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+-- Структурированный отчёт об ошибках проверки полей заказа
+ALTER TABLE dead_letters ADD COLUMN details JSONB;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS orders_created_at_idx;
+DROP FUNCTION IF EXISTS orders_created_at(TEXT);
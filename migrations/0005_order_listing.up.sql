@@ -0,0 +1,14 @@
+-- Момент создания заказа для сортировки и отбора по date_created.
+-- date_created хранится текстом, и заказы, сохранённые до проверки полей, могут содержать
+-- некорректную дату: функция возвращает для них NULL вместо ошибки всего запроса.
+-- Приведение ::timestamptz для строки без смещения зависит от TimeZone сеанса, поэтому
+-- функция переопределена в миграции 0008 с разбором без учёта параметров сеанса.
+CREATE OR REPLACE FUNCTION orders_created_at(value TEXT) RETURNS TIMESTAMPTZ AS $$
+BEGIN
+    RETURN value::timestamptz;
+EXCEPTION WHEN others THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+CREATE INDEX IF NOT EXISTS orders_created_at_idx ON orders (orders_created_at(date_created), order_uid);
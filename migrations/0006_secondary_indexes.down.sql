@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS payment_transaction_idx;
+DROP INDEX IF EXISTS orders_customer_id_idx;
+DROP INDEX IF EXISTS orders_track_number_idx;
@@ -0,0 +1,4 @@
+-- Индексы для поиска заказов по трек-номеру, покупателю и транзакции оплаты
+CREATE INDEX IF NOT EXISTS orders_track_number_idx ON orders (track_number);
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id, order_uid);
+CREATE INDEX IF NOT EXISTS payment_transaction_idx ON payment (transaction);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS orders_search_vector_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS orders_search_vector(TEXT);
@@ -0,0 +1,16 @@
+-- Документ полнотекстового поиска заказа: бренды (вес A) и названия (B) товаров,
+-- имя получателя (C) и город (D) доставки. Конфигурация simple не приводит слова к основе,
+-- только к нижнему регистру, но разбивает текст анализатором PostgreSQL: слова через дефис,
+-- адреса сайтов и почты делятся не так, как при поиске в кеше (см. searchTokens).
+CREATE OR REPLACE FUNCTION orders_search_vector(uid TEXT) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('simple', COALESCE((SELECT string_agg(brand, ' ') FROM items WHERE order_uid = uid), '')), 'A') ||
+           setweight(to_tsvector('simple', COALESCE((SELECT string_agg(name, ' ') FROM items WHERE order_uid = uid), '')), 'B') ||
+           setweight(to_tsvector('simple', COALESCE((SELECT name FROM delivery WHERE order_uid = uid), '')), 'C') ||
+           setweight(to_tsvector('simple', COALESCE((SELECT city FROM delivery WHERE order_uid = uid), '')), 'D');
+$$ LANGUAGE sql STABLE;
+
+-- Документ хранится в заказе и обновляется приложением при каждом сохранении
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS search_vector tsvector;
+UPDATE orders SET search_vector = orders_search_vector(order_uid);
+
+CREATE INDEX IF NOT EXISTS orders_search_vector_idx ON orders USING GIN (search_vector);
@@ -0,0 +1,9 @@
+CREATE OR REPLACE FUNCTION orders_created_at(value TEXT) RETURNS TIMESTAMPTZ AS $$
+BEGIN
+    RETURN value::timestamptz;
+EXCEPTION WHEN others THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+REINDEX INDEX orders_created_at_idx;
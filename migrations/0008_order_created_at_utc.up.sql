@@ -0,0 +1,36 @@
+-- Момент создания заказа без зависимости от параметров сеанса.
+-- Приведение value::timestamptz из миграции 0005 для строки без смещения часового пояса
+-- берёт часовой пояс из параметра TimeZone сеанса, поэтому функция не была IMMUTABLE
+-- и индекс мог расходиться с результатом запроса. Теперь дата разбирается по формату RFC3339
+-- вручную: смещение обязательно, строка без него или с некорректной датой даёт NULL,
+-- как и при разборе time.RFC3339 в сервисе.
+CREATE OR REPLACE FUNCTION orders_created_at(value TEXT) RETURNS TIMESTAMPTZ AS $$
+DECLARE
+    parts  TEXT[];
+    moment TIMESTAMP;
+    shift  INTERVAL;
+BEGIN
+    parts := regexp_match(value,
+        '^(\d{4})-(\d{2})-(\d{2})T(\d{2}):(\d{2}):(\d{2}(?:\.\d+)?)(?:(Z)|([+-])(\d{2}):(\d{2}))$');
+    IF parts IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    moment := make_timestamp(parts[1]::INT, parts[2]::INT, parts[3]::INT,
+                             parts[4]::INT, parts[5]::INT, parts[6]::DOUBLE PRECISION);
+    IF parts[7] IS NULL THEN
+        shift := make_interval(hours => parts[9]::INT, mins => parts[10]::INT);
+        IF parts[8] = '-' THEN
+            moment := moment + shift;
+        ELSE
+            moment := moment - shift;
+        END IF;
+    END IF;
+    RETURN moment AT TIME ZONE 'UTC';
+EXCEPTION WHEN others THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- Значения функции для строк без смещения изменились, индекс строится заново
+REINDEX INDEX orders_created_at_idx;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS orders_order_uid_c_idx;
+
+DROP INDEX IF EXISTS orders_created_at_idx;
+CREATE INDEX orders_created_at_idx ON orders (orders_created_at(date_created), order_uid);
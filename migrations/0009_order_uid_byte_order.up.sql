@@ -0,0 +1,7 @@
+-- Сортировка и постраничное чтение по order_uid выполняются в порядке байтов (COLLATE "C"),
+-- как в кеше и в хранилищах SQLite и в памяти. Первичный ключ использует правило сравнения
+-- базы по умолчанию и для такой сортировки не подходит, поэтому нужны отдельные индексы.
+CREATE INDEX IF NOT EXISTS orders_order_uid_c_idx ON orders (order_uid COLLATE "C");
+
+DROP INDEX IF EXISTS orders_created_at_idx;
+CREATE INDEX orders_created_at_idx ON orders (orders_created_at(date_created), order_uid COLLATE "C");
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("Ошибка чтения встроенных миграций: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Не найдено ни одной миграции")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("Ожидалась версия %d, получено: %d", i+1, m.Version)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("У миграции %d отсутствует up или down", m.Version)
+		}
+	}
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"container/heap"
+	"container/list"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Политики вытеснения заказов из кеша
+const (
+	EvictLRU = "lru" // Вытесняется заказ, к которому дольше всего не обращались
+	EvictLFU = "lfu" // Вытесняется заказ с наименьшим количеством обращений
+	EvictTTL = "ttl" // Вытесняется заказ, добавленный раньше всех (первым истекает cache.ttl)
+)
+
+// Ограниченный кеш заказов.
+// Размер ограничивается количеством записей и приблизительным объёмом занимаемой памяти;
+// при превышении любого из ограничений заказы вытесняются по выбранной политике.
+// Источником истины остаётся хранилище: вытесненный заказ будет загружен повторно при запросе.
+//
+// Кеш разделён на cache.shards независимых сегментов со своими блокировками, сегмент
+// выбирается по хешу order_uid. Ограничения размера делятся между сегментами поровну,
+// поэтому вытеснение выполняется в пределах сегмента и является приблизительным для кеша в целом.
+type OrderCache struct {
+	shards []*cacheShard
+
+	policyName string
+	maxEntries int
+	maxBytes   int64
+}
+
+// Сегмент кеша с собственной блокировкой и порядком вытеснения
+type cacheShard struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	indexes [indexCount]secondaryIndex // Вторичные индексы по записям сегмента
+	text    *textIndex                 // Инвертированный индекс для полнотекстового поиска
+	policy  evictionPolicy
+	bytes   int64
+	tick    uint64
+
+	// Не позднее этого момента истекает самая ранняя запись сегмента,
+	// нулевое значение - истекающих записей нет
+	nextExpiry time.Time
+
+	maxEntries  int
+	maxBytes    int64
+	ttl         time.Duration
+	gzipMinSize int
+
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+	expirations uint64
+}
+
+// Запись кеша
+type cacheEntry struct {
+	order   Order
+	encoded *encodedOrder // Готовый ответ: JSON, сжатое представление и ETag
+	size    int64
+	expires time.Time // Нулевое значение - запись не истекает
+	hits    uint64    // Количество обращений для LFU
+	tick    uint64    // Момент последнего обращения для LFU при равном количестве обращений
+
+	elem  *list.Element // Позиция в списке LRU и TTL
+	index int           // Позиция в куче LFU
+}
+
+// Статистика работы кеша
+type CacheStats struct {
+	Policy      string `json:"policy"`
+	Shards      int    `json:"shards"`
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+	MaxEntries  int    `json:"max_entries"`
+	MaxBytes    int64  `json:"max_bytes"`
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`   // Вытеснено из-за ограничений размера
+	Expirations uint64 `json:"expirations"` // Удалено по истечении cache.ttl
+}
+
+// Кеш заказов, используемый приложением
+var orderCache = newOrderCache(defaultConfig().Cache)
+
+// Функция создания пустого кеша с ограничениями из конфигурации.
+// Нулевые max_entries и max_bytes означают отсутствие соответствующего ограничения.
+func newOrderCache(cfg CacheConfig) *OrderCache {
+	n := cfg.Shards
+	if n < 1 {
+		n = 1
+	}
+	c := &OrderCache{
+		shards:     make([]*cacheShard, n),
+		policyName: cfg.Policy,
+		maxEntries: cfg.MaxEntries,
+		maxBytes:   cfg.MaxBytes,
+	}
+	if c.policyName != EvictLFU && c.policyName != EvictTTL {
+		c.policyName = EvictLRU
+	}
+
+	for i := range c.shards {
+		shard := &cacheShard{
+			entries:     make(map[string]*cacheEntry),
+			indexes:     newSecondaryIndexes(),
+			text:        newTextIndex(),
+			ttl:         cfg.TTL,
+			gzipMinSize: cfg.GzipMinSize,
+			// Ограничения округляются вверх, чтобы маленький кеш не оказался с нулевыми сегментами
+			maxEntries: (cfg.MaxEntries + n - 1) / n,
+			maxBytes:   (cfg.MaxBytes + int64(n) - 1) / int64(n),
+		}
+		switch c.policyName {
+		case EvictLFU:
+			shard.policy = &lfuPolicy{}
+		case EvictTTL:
+			shard.policy = &fifoPolicy{list: list.New()}
+		default:
+			shard.policy = &lruPolicy{list: list.New()}
+		}
+		c.shards[i] = shard
+	}
+	return c
+}
+
+// Функция выбора сегмента по хешу FNV-1a от order_uid
+func (c *OrderCache) shard(uid string) *cacheShard {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(uid); i++ {
+		h ^= uint32(uid[i])
+		h *= 16777619
+	}
+	return c.shards[h%uint32(len(c.shards))]
+}
+
+// Функция получения заказа из кеша
+func (c *OrderCache) Get(uid string) (Order, bool) {
+	e, ok := c.shard(uid).get(uid)
+	if !ok {
+		return Order{}, false
+	}
+	return e.order, true
+}
+
+// Функция получения заказа из кеша в готовом для ответа виде
+func (c *OrderCache) GetEncoded(uid string) (*encodedOrder, bool) {
+	e, ok := c.shard(uid).get(uid)
+	if !ok {
+		return nil, false
+	}
+	return e.encoded, true
+}
+
+// Функция добавления или замены заказа в кеше с вытеснением при превышении ограничений.
+// Заказ кодируется для ответа до захвата блокировки сегмента.
+func (c *OrderCache) Set(order Order) {
+	shard := c.shard(order.OrderUID)
+	encoded, err := encodeOrder(order, shard.gzipMinSize)
+	if err != nil {
+		log.Printf("Ошибка кодирования заказа %s, заказ не добавлен в кеш: %v", order.OrderUID, err)
+		shard.delete(order.OrderUID)
+		return
+	}
+	shard.set(order, encoded)
+}
+
+// Функция добавления заказа, прочитанного из хранилища, только если его ещё нет в кеше.
+// Пока шло чтение, в кеш мог попасть более новый заказ из брокера, и прочитанные данные
+// не должны его заменить. Возвращает заказ из кеша и его закодированный вид; nil вместо
+// закодированного вида означает ошибку кодирования, тогда заказ в кеш не добавляется.
+func (c *OrderCache) Add(order Order) (Order, *encodedOrder) {
+	shard := c.shard(order.OrderUID)
+	encoded, err := encodeOrder(order, shard.gzipMinSize)
+	if err != nil {
+		log.Printf("Ошибка кодирования заказа %s, заказ не добавлен в кеш: %v", order.OrderUID, err)
+		return order, nil
+	}
+	return shard.add(order, encoded)
+}
+
+// Функция удаления заказа из кеша
+func (c *OrderCache) Delete(uid string) {
+	c.shard(uid).delete(uid)
+}
+
+// Функция получения копии всех неистёкших заказов кеша, например для записи снимка.
+// Сегменты блокируются по очереди, поэтому копия согласована в пределах сегмента.
+func (c *OrderCache) Orders() []Order {
+	var orders []Order
+	now := time.Now()
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		for _, e := range shard.entries {
+			if e.expires.IsZero() || now.Before(e.expires) {
+				orders = append(orders, e.order)
+			}
+		}
+		shard.mu.Unlock()
+	}
+	return orders
+}
+
+// Функция поиска заказов в кеше по вторичному индексу.
+// Кеш ограничен, поэтому результат содержит только заказы, находящиеся в кеше.
+func (c *OrderCache) Find(index CacheIndex, value string) []Order {
+	if value == "" {
+		return nil
+	}
+	var orders []Order
+	now := time.Now()
+	for _, shard := range c.shards {
+		orders = append(orders, shard.find(index, value, now)...)
+	}
+	return orders
+}
+
+// Функция выбора заказов кеша, среди которых находятся удовлетворяющие filter.
+// Если в условиях есть поле со вторичным индексом, просматриваются только заказы из индекса.
+func (c *OrderCache) Candidates(filter OrderFilter) []Order {
+	switch {
+	case filter.TrackNumber != "":
+		return c.Find(IndexTrackNumber, filter.TrackNumber)
+	case filter.Transaction != "":
+		return c.Find(IndexTransaction, filter.Transaction)
+	case filter.CustomerID != "":
+		return c.Find(IndexCustomer, filter.CustomerID)
+	}
+	return c.Orders()
+}
+
+// Функция полнотекстового поиска по заказам кеша.
+// Заказы возвращаются в порядке убывания релевантности, не более query.Limit.
+func (c *OrderCache) Search(query SearchQuery) []Order {
+	var found []scoredOrder
+	now := time.Now()
+	for _, shard := range c.shards {
+		found = append(found, shard.search(query.Terms, now)...)
+	}
+	return rankSearchResults(found, query.Limit)
+}
+
+// Функция проверки, что хотя бы один сегмент заполнен до своей доли ограничений.
+// Вытеснение выполняется в пределах сегмента, поэтому следующий заказ, попавший
+// в такой сегмент, вытеснил бы уже загруженный, даже если кеш в целом заполнен не полностью.
+// По объёму сегмент считается заполненным, если в него не помещается ещё одна запись среднего размера.
+func (c *OrderCache) Full() bool {
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		n := int64(len(shard.entries))
+		full := (shard.maxEntries > 0 && len(shard.entries) >= shard.maxEntries) ||
+			(shard.maxBytes > 0 && n > 0 && shard.bytes+shard.bytes/n > shard.maxBytes)
+		shard.mu.Unlock()
+		if full {
+			return true
+		}
+	}
+	return false
+}
+
+// Функция получения статистики кеша, суммированной по сегментам
+func (c *OrderCache) Stats() CacheStats {
+	stats := CacheStats{
+		Policy:     c.policyName,
+		Shards:     len(c.shards),
+		MaxEntries: c.maxEntries,
+		MaxBytes:   c.maxBytes,
+	}
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		stats.Entries += len(shard.entries)
+		stats.Bytes += shard.bytes
+		stats.Hits += shard.hits
+		stats.Misses += shard.misses
+		stats.Evictions += shard.evictions
+		stats.Expirations += shard.expirations
+		shard.mu.Unlock()
+	}
+	return stats
+}
+
+// Обработчик получения статистики кеша заказов
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, orderCache.Stats())
+}
+
+func (c *cacheShard) get(uid string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[uid]
+	if ok && !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.removeEntry(uid, e)
+		c.expirations++
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.tick++
+	e.hits++
+	e.tick = c.tick
+	c.policy.touch(e)
+	return e, true
+}
+
+func (c *cacheShard) set(order Order, encoded *encodedOrder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store(order, encoded)
+}
+
+// Функция добавления заказа, только если в сегменте нет неистёкшей записи с тем же order_uid.
+// Возвращает заказ, который находится в кеше после вызова.
+func (c *cacheShard) add(order Order, encoded *encodedOrder) (Order, *encodedOrder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[order.OrderUID]; ok && (e.expires.IsZero() || time.Now().Before(e.expires)) {
+		return e.order, e.encoded
+	}
+	c.store(order, encoded)
+	return order, encoded
+}
+
+// Функция записи заказа в сегмент. Вызывается под блокировкой сегмента.
+func (c *cacheShard) store(order Order, encoded *encodedOrder) {
+	c.tick++
+	size := estimateOrderSize(order) + encoded.size()
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+		if c.nextExpiry.IsZero() {
+			c.nextExpiry = expires
+		}
+	}
+
+	e, ok := c.entries[order.OrderUID]
+	if ok {
+		c.policy.remove(e)
+		c.unindex(e.order)
+		c.bytes += size - e.size
+		e.order, e.encoded, e.size, e.expires, e.tick = order, encoded, size, expires, c.tick
+	} else {
+		e = &cacheEntry{order: order, encoded: encoded, size: size, expires: expires, tick: c.tick}
+		c.entries[order.OrderUID] = e
+		c.bytes += size
+	}
+	c.index(order)
+
+	// Истёкшие записи занимают место до первого обращения к ним,
+	// поэтому освобождаются раньше, чем вытесняются действующие
+	if c.ttl > 0 && c.overLimit() {
+		c.removeExpired(time.Now())
+	}
+
+	// Добавляемый заказ не участвует в выборе вытесняемых, иначе при LFU
+	// новый заказ без обращений вытеснялся бы сразу после добавления
+	for len(c.entries) > 1 && c.overLimit() {
+		victim := c.policy.victim()
+		c.removeEntry(victim.order.OrderUID, victim)
+		c.evictions++
+	}
+	c.policy.add(e)
+
+	// Заказ, который один превышает cache.max_bytes, в кеше не хранится
+	if c.overLimit() {
+		c.removeEntry(order.OrderUID, e)
+		c.evictions++
+	}
+}
+
+func (c *cacheShard) delete(uid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[uid]; ok {
+		c.removeEntry(uid, e)
+	}
+}
+
+func (c *cacheShard) overLimit() bool {
+	return (c.maxEntries > 0 && len(c.entries) > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+// Функция удаления истёкших записей сегмента. Вызывается под блокировкой сегмента.
+// Записи просматриваются, только если срок самой ранней из них уже прошёл.
+func (c *cacheShard) removeExpired(now time.Time) {
+	if c.nextExpiry.IsZero() || now.Before(c.nextExpiry) {
+		return
+	}
+	c.nextExpiry = time.Time{}
+	for uid, e := range c.entries {
+		switch {
+		case e.expires.IsZero():
+		case !now.Before(e.expires):
+			c.removeEntry(uid, e)
+			c.expirations++
+		case c.nextExpiry.IsZero() || e.expires.Before(c.nextExpiry):
+			c.nextExpiry = e.expires
+		}
+	}
+}
+
+func (c *cacheShard) removeEntry(uid string, e *cacheEntry) {
+	c.policy.remove(e)
+	c.unindex(e.order)
+	delete(c.entries, uid)
+	c.bytes -= e.size
+}
+
+func (c *cacheShard) index(order Order) {
+	for i, ix := range c.indexes {
+		ix.add(cacheIndexKeys[i](order), order.OrderUID)
+	}
+	c.text.add(order)
+}
+
+func (c *cacheShard) unindex(order Order) {
+	for i, ix := range c.indexes {
+		ix.remove(cacheIndexKeys[i](order), order.OrderUID)
+	}
+	c.text.remove(order)
+}
+
+// Функция полнотекстового поиска среди неистёкших заказов сегмента
+func (c *cacheShard) search(terms []SearchTerm, now time.Time) []scoredOrder {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var found []scoredOrder
+	for uid, score := range c.text.search(terms) {
+		if e := c.entries[uid]; e.expires.IsZero() || now.Before(e.expires) {
+			found = append(found, scoredOrder{order: e.order, score: score})
+		}
+	}
+	return found
+}
+
+// Функция поиска неистёкших заказов сегмента по значению вторичного индекса
+func (c *cacheShard) find(index CacheIndex, value string, now time.Time) []Order {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var orders []Order
+	for uid := range c.indexes[index][value] {
+		if e := c.entries[uid]; e.expires.IsZero() || now.Before(e.expires) {
+			orders = append(orders, e.order)
+		}
+	}
+	return orders
+}
+
+// Вторичные индексы кеша
+type CacheIndex int
+
+const (
+	IndexTrackNumber CacheIndex = iota // track_number
+	IndexCustomer                      // customer_id
+	IndexTransaction                   // payment.transaction
+	indexCount
+)
+
+// Значения полей заказа для каждого вторичного индекса
+var cacheIndexKeys = [indexCount]func(o Order) string{
+	IndexTrackNumber: func(o Order) string { return o.TrackNumber },
+	IndexCustomer:    func(o Order) string { return o.CustomerID },
+	IndexTransaction: func(o Order) string { return o.Payment.Transaction },
+}
+
+// Вторичный индекс: значение поля -> множество order_uid.
+// Индексы обновляются вместе с записями сегмента под его блокировкой при добавлении,
+// замене, удалении, вытеснении и истечении записи, поэтому не расходятся с ними.
+type secondaryIndex map[string]map[string]struct{}
+
+func newSecondaryIndexes() [indexCount]secondaryIndex {
+	var indexes [indexCount]secondaryIndex
+	for i := range indexes {
+		indexes[i] = make(secondaryIndex)
+	}
+	return indexes
+}
+
+func (ix secondaryIndex) add(value, uid string) {
+	if value == "" {
+		return
+	}
+	uids, ok := ix[value]
+	if !ok {
+		uids = make(map[string]struct{}, 1)
+		ix[value] = uids
+	}
+	uids[uid] = struct{}{}
+}
+
+func (ix secondaryIndex) remove(value, uid string) {
+	uids, ok := ix[value]
+	if !ok {
+		return
+	}
+	delete(uids, uid)
+	if len(uids) == 0 {
+		delete(ix, value)
+	}
+}
+
+// Порядок вытеснения записей кеша. Методы вызываются под блокировкой кеша.
+type evictionPolicy interface {
+	add(e *cacheEntry)    // Добавление новой или заменённой записи
+	touch(e *cacheEntry)  // Обращение к записи
+	remove(e *cacheEntry) // Удаление записи
+	victim() *cacheEntry  // Следующая запись на вытеснение
+}
+
+// LRU: в начале списка записи, к которым обращались последними
+type lruPolicy struct {
+	list *list.List
+}
+
+func (p *lruPolicy) add(e *cacheEntry)    { e.elem = p.list.PushFront(e) }
+func (p *lruPolicy) touch(e *cacheEntry)  { p.list.MoveToFront(e.elem) }
+func (p *lruPolicy) remove(e *cacheEntry) { p.list.Remove(e.elem) }
+func (p *lruPolicy) victim() *cacheEntry  { return p.list.Back().Value.(*cacheEntry) }
+
+// TTL: записи упорядочены по моменту добавления, а значит и по моменту истечения
+type fifoPolicy struct {
+	list *list.List
+}
+
+func (p *fifoPolicy) add(e *cacheEntry)    { e.elem = p.list.PushBack(e) }
+func (p *fifoPolicy) touch(e *cacheEntry)  {}
+func (p *fifoPolicy) remove(e *cacheEntry) { p.list.Remove(e.elem) }
+func (p *fifoPolicy) victim() *cacheEntry  { return p.list.Front().Value.(*cacheEntry) }
+
+// LFU: куча по количеству обращений, при равенстве раньше вытесняется давно использованная запись
+type lfuPolicy struct {
+	heap lfuHeap
+}
+
+func (p *lfuPolicy) add(e *cacheEntry)    { heap.Push(&p.heap, e) }
+func (p *lfuPolicy) touch(e *cacheEntry)  { heap.Fix(&p.heap, e.index) }
+func (p *lfuPolicy) remove(e *cacheEntry) { heap.Remove(&p.heap, e.index) }
+func (p *lfuPolicy) victim() *cacheEntry  { return p.heap[0] }
+
+type lfuHeap []*cacheEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].hits != h[j].hits {
+		return h[i].hits < h[j].hits
+	}
+	return h[i].tick < h[j].tick
+}
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*cacheEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
+
+// Приблизительный объём памяти, занимаемый записью кеша с заказом: размеры структур
+// и содержимое строк, без учёта служебных данных распределителя памяти
+func estimateOrderSize(o Order) int64 {
+	size := int64(unsafe.Sizeof(cacheEntry{})) + int64(unsafe.Sizeof(o))
+	size += int64(len(o.OrderUID)*2 + len(o.TrackNumber) + len(o.Entry) + len(o.Locale) + len(o.InternalSignature) +
+		len(o.CustomerID) + len(o.DeliveryService) + len(o.ShardKey) + len(o.DateCreated) + len(o.OOFShard))
+	d := o.Delivery
+	size += int64(len(d.Name) + len(d.Phone) + len(d.Zip) + len(d.City) + len(d.Address) + len(d.Region) + len(d.Email))
+	p := o.Payment
+	size += int64(len(p.Transaction) + len(p.RequestID) + len(p.Currency) + len(p.Provider) + len(p.Bank))
+	for _, item := range o.Items {
+		size += int64(unsafe.Sizeof(item))
+		size += int64(len(item.TrackNumber) + len(item.RID) + len(item.Name) + len(item.Size) + len(item.Brand))
+	}
+	return size
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Функция проверки наличия заказов в кеше без учёта обращения в статистике политики
+func cachedUIDs(c *OrderCache) map[string]bool {
+	uids := make(map[string]bool)
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		for uid := range shard.entries {
+			uids[uid] = true
+		}
+		shard.mu.Unlock()
+	}
+	return uids
+}
+
+func TestOrderCache_LRU(t *testing.T) {
+	c := newOrderCache(CacheConfig{Policy: EvictLRU, MaxEntries: 2})
+	c.Set(newTestOrder("a"))
+	c.Set(newTestOrder("b"))
+	c.Get("a") // b становится давно неиспользуемым
+	c.Set(newTestOrder("c"))
+
+	uids := cachedUIDs(c)
+	if !uids["a"] || uids["b"] || !uids["c"] {
+		t.Errorf("Ожидалось вытеснение b, в кеше: %v", uids)
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Entries != 2 {
+		t.Errorf("Ожидались 1 вытеснение и 2 записи, получено: %+v", stats)
+	}
+}
+
+func TestOrderCache_LFU(t *testing.T) {
+	c := newOrderCache(CacheConfig{Policy: EvictLFU, MaxEntries: 2})
+	c.Set(newTestOrder("a"))
+	c.Set(newTestOrder("b"))
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+	c.Set(newTestOrder("c")) // Вытесняется b с одним обращением
+	c.Get("c")
+	c.Get("c")
+	c.Get("c")
+	c.Set(newTestOrder("d")) // Вытесняется a: у c больше обращений
+
+	uids := cachedUIDs(c)
+	if uids["a"] || uids["b"] || !uids["c"] || !uids["d"] {
+		t.Errorf("Ожидались в кеше c и d, получено: %v", uids)
+	}
+}
+
+func TestOrderCache_TTL(t *testing.T) {
+	c := newOrderCache(CacheConfig{Policy: EvictTTL, TTL: 20 * time.Millisecond})
+	c.Set(newTestOrder("a"))
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Заказ должен быть в кеше до истечения ttl")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("Заказ не должен возвращаться после истечения ttl")
+	}
+	if stats := c.Stats(); stats.Expirations != 1 || stats.Entries != 0 || stats.Misses != 1 {
+		t.Errorf("Ожидались 1 истечение и пустой кеш, получено: %+v", stats)
+	}
+}
+
+func TestOrderCache_MaxBytes(t *testing.T) {
+	encoded, _ := encodeOrder(newTestOrder("a"), 0)
+	size := estimateOrderSize(newTestOrder("a")) + encoded.size()
+	c := newOrderCache(CacheConfig{Policy: EvictLRU, MaxBytes: size*2 + size/2})
+	for _, uid := range []string{"a", "b", "c", "d"} {
+		c.Set(newTestOrder(uid))
+	}
+
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.Bytes > stats.MaxBytes {
+		t.Errorf("Ожидались 2 записи в пределах %d байт, получено: %+v", stats.MaxBytes, stats)
+	}
+
+	// Замена заказа не меняет учтённый объём при том же размере
+	c.Set(newTestOrder("d"))
+	if c.Stats().Bytes != stats.Bytes {
+		t.Errorf("Объём изменился при замене заказа: %d -> %d", stats.Bytes, c.Stats().Bytes)
+	}
+}
+
+func TestOrderCache_ExpiredFreeSpace(t *testing.T) {
+	encoded, _ := encodeOrder(newTestOrder("a"), 0)
+	size := estimateOrderSize(newTestOrder("a")) + encoded.size()
+	c := newOrderCache(CacheConfig{Policy: EvictLRU, MaxBytes: size*2 + size/2, TTL: 20 * time.Millisecond})
+	c.Set(newTestOrder("a"))
+	c.Set(newTestOrder("b"))
+
+	// Истёкшие a и b освобождают место, действующие записи не вытесняются
+	time.Sleep(30 * time.Millisecond)
+	c.Set(newTestOrder("c"))
+	c.Set(newTestOrder("d"))
+
+	stats := c.Stats()
+	if stats.Entries != 2 || stats.Expirations != 2 || stats.Evictions != 0 {
+		t.Errorf("Ожидались 2 записи, 2 истечения и ни одного вытеснения, получено: %+v", stats)
+	}
+	if uids := cachedUIDs(c); !uids["c"] || !uids["d"] {
+		t.Errorf("Ожидались в кеше c и d, получено: %v", uids)
+	}
+}
+
+func TestOrderCache_FullPerShard(t *testing.T) {
+	c := newOrderCache(CacheConfig{Policy: EvictLRU, MaxEntries: 100, Shards: 8})
+	added := 0
+	for !c.Full() {
+		c.Set(newTestOrder(fmt.Sprintf("order-%d", added)))
+		added++
+		if added > 1000 {
+			t.Fatal("Кеш не сообщил о заполнении")
+		}
+	}
+
+	// Заполнение обнаруживается до того, как сегмент начнёт вытеснять загруженные заказы
+	stats := c.Stats()
+	if stats.Evictions != 0 || stats.Entries != added || stats.Entries > 100 {
+		t.Errorf("Ожидалось %d записей без вытеснений, получено: %+v", added, stats)
+	}
+}
+
+func TestOrderCache_Sharded(t *testing.T) {
+	c := newOrderCache(CacheConfig{Policy: EvictLRU, MaxEntries: 1000, Shards: 8})
+	for i := 0; i < 2000; i++ {
+		c.Set(newTestOrder(fmt.Sprintf("order-%d", i)))
+	}
+
+	// Ограничение делится между сегментами, поэтому общий размер не превышает max_entries
+	stats := c.Stats()
+	if stats.Entries > 1000 || stats.Entries < 900 || stats.Shards != 8 {
+		t.Errorf("Ожидалось около 1000 записей в 8 сегментах, получено: %+v", stats)
+	}
+	for i, shard := range c.shards {
+		if len(shard.entries) == 0 {
+			t.Errorf("Сегмент %d пуст, order_uid распределяются неравномерно", i)
+		}
+	}
+	if _, ok := c.Get("order-1999"); !ok {
+		t.Error("Последний добавленный заказ должен быть в кеше")
+	}
+}
+
+// Функция получения отсортированных order_uid найденных по индексу заказов
+func foundUIDs(c *OrderCache, index CacheIndex, value string) string {
+	var uids []string
+	for _, order := range c.Find(index, value) {
+		uids = append(uids, order.OrderUID)
+	}
+	sort.Strings(uids)
+	return strings.Join(uids, ",")
+}
+
+func TestOrderCache_SecondaryIndexes(t *testing.T) {
+	c := newOrderCache(CacheConfig{Policy: EvictLRU, MaxEntries: 3, Shards: 1})
+	for _, uid := range []string{"a", "b", "c"} {
+		order := newTestOrder(uid)
+		order.TrackNumber = "TRACK-1"
+		order.CustomerID = "customer-" + uid
+		c.Set(order)
+	}
+	if got := foundUIDs(c, IndexTrackNumber, "TRACK-1"); got != "a,b,c" {
+		t.Errorf("По трек-номеру ожидались a,b,c, получено: %s", got)
+	}
+	if got := foundUIDs(c, IndexTransaction, "b"); got != "b" {
+		t.Errorf("По транзакции ожидался b, получено: %s", got)
+	}
+
+	// Замена заказа переносит его в индексе на новое значение
+	order := newTestOrder("b")
+	order.TrackNumber = "TRACK-2"
+	order.CustomerID = "customer-b"
+	c.Set(order)
+	if got := foundUIDs(c, IndexTrackNumber, "TRACK-1"); got != "a,c" {
+		t.Errorf("После замены по старому трек-номеру ожидались a,c, получено: %s", got)
+	}
+	if got := foundUIDs(c, IndexTrackNumber, "TRACK-2"); got != "b" {
+		t.Errorf("После замены по новому трек-номеру ожидался b, получено: %s", got)
+	}
+
+	// Вытесненный и удалённый заказы пропадают из индексов
+	c.Set(newTestOrder("d")) // Вытесняется давно неиспользуемый a
+	c.Delete("c")
+	if got := foundUIDs(c, IndexTrackNumber, "TRACK-1"); got != "" {
+		t.Errorf("После вытеснения и удаления по трек-номеру ничего не ожидалось, получено: %s", got)
+	}
+	if got := foundUIDs(c, IndexCustomer, "customer-a"); got != "" {
+		t.Errorf("Вытесненный заказ остался в индексе покупателей: %s", got)
+	}
+	for i, ix := range c.shards[0].indexes {
+		for value, uids := range ix {
+			for uid := range uids {
+				if _, ok := c.shards[0].entries[uid]; !ok {
+					t.Errorf("Индекс %d: значение %s ссылается на отсутствующий заказ %s", i, value, uid)
+				}
+			}
+		}
+	}
+}
+
+func TestOrderCache_SecondaryIndexTTL(t *testing.T) {
+	c := newOrderCache(CacheConfig{Policy: EvictTTL, TTL: 20 * time.Millisecond})
+	c.Set(newTestOrder("a"))
+	if got := foundUIDs(c, IndexTrackNumber, "WBILMTESTTRACK"); got != "a" {
+		t.Fatalf("По трек-номеру ожидался a, получено: %s", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := foundUIDs(c, IndexTrackNumber, "WBILMTESTTRACK"); got != "" {
+		t.Errorf("Истёкший заказ не должен находиться по индексу, получено: %s", got)
+	}
+}
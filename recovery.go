@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Источники восстановления кеша при запуске
+const (
+	RestoreFromDB     = "db"     // Чтение всех заказов из хранилища
+	RestoreFromReplay = "replay" // Повторное чтение канала с позиции restore.replay_from и сверка с хранилищем
+)
+
+// Максимальное количество order_uid каждого вида расхождений в отчётах о восстановлении и сверке
+const reportSampleSize = 100
+
+// Отчёт о восстановлении кеша из канала и сверке с хранилищем
+type recoveryReport struct {
+	From       string    `json:"from"` // Позиция начала чтения канала
+	StartedAt  time.Time `json:"started_at"`
+	Duration   string    `json:"duration"`
+	Messages   int       `json:"messages"`        // Прочитано сообщений
+	Invalid    int       `json:"invalid"`         // Сообщения с некорректными данными заказа
+	Orders     int       `json:"orders"`          // Различных заказов в канале
+	Cached     int       `json:"cached"`          // Заказов добавлено в кеш
+	Reconciled bool      `json:"reconciled"`      // Сверка с хранилищем выполнена
+	Matched    int       `json:"matched"`         // Заказы, найденные и в канале, и в хранилище
+	OnlyInDB   int       `json:"only_in_db"`      // Заказы из хранилища, которых нет в прочитанной части канала
+	OnlyInChan int       `json:"only_in_channel"` // Заказы из канала, которых нет в хранилище
+	Error      string    `json:"error,omitempty"` // Ошибка сверки, если она не выполнена
+
+	// Примеры order_uid расхождений, не более reportSampleSize каждого вида
+	OnlyInDBSample   []string `json:"only_in_db_sample,omitempty"`
+	OnlyInChanSample []string `json:"only_in_channel_sample,omitempty"`
+}
+
+// Отчёт о последнем восстановлении кеша из канала
+var lastRecoveryReport atomic.Pointer[recoveryReport]
+
+// Функция восстановления кеша повторным чтением канала временной подпиской.
+// Заказы из канала применяются к кешу пачками по restore.batch_size, поэтому в памяти
+// держатся не более одной пачки заказов и множество прочитанных order_uid; для каждого
+// order_uid в кеше остаётся последнее корректное сообщение. Затем все заказы хранилища
+// сверяются с прочитанными: заказы, найденные в обоих источниках, заменяются в кеше версией
+// из хранилища, потому что при политиках ignore и reject-if-different она может отличаться
+// от последнего сообщения. Если сверка не удалась, в кеше остаются данные из канала.
+//
+// Заказы, которые есть только в хранилище, в кеш не добавляются и загружаются при запросе;
+// при чтении не с начала канала их наличие ожидаемо. Заказы только из канала удаляются
+// из кеша: они были отклонены или ещё не обработаны и придут через durable-подписку.
+func restoreCacheFromReplay(ctx context.Context, consumer OrderConsumer) (*recoveryReport, error) {
+	cfg := currentConfig().Restore
+	from, err := parseReplayPosition(cfg.ReplayFrom)
+	if err != nil {
+		return nil, fmt.Errorf("некорректная restore.replay_from: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	report := &recoveryReport{From: cfg.ReplayFrom, StartedAt: time.Now().UTC()}
+	channelUIDs := make(map[string]struct{})
+	pending := make(map[string]Order, cfg.BatchSize)
+	flush := func() {
+		for _, order := range pending {
+			orderCache.Set(order)
+		}
+		clear(pending)
+	}
+	var last uint64
+	err = consumer.Replay(ctx, from, func(msg *consumerMessage) {
+		report.Messages++
+		last = max(last, msg.Sequence)
+		var order Order
+		if err := json.Unmarshal(msg.Data, &order); err != nil || order.Validate() != nil {
+			report.Invalid++
+			return
+		}
+		channelUIDs[order.OrderUID] = struct{}{}
+		pending[order.OrderUID] = order
+		if len(pending) >= cfg.BatchSize {
+			flush()
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка повторного чтения канала: %w", err)
+	}
+	flush()
+	report.Orders = len(channelUIDs)
+
+	// Хранилище читается в порядке order_uid, поэтому первые order_uid и есть пример для отчёта
+	var onlyInDB []string
+	err = repo.Stream(ctx, cfg.BatchSize, func(batch OrderBatch) error {
+		for _, order := range batch.Orders {
+			if _, ok := channelUIDs[order.OrderUID]; !ok {
+				report.OnlyInDB++
+				if len(onlyInDB) < reportSampleSize {
+					onlyInDB = append(onlyInDB, order.OrderUID)
+				}
+				continue
+			}
+			delete(channelUIDs, order.OrderUID)
+			report.Matched++
+			orderCache.Set(order)
+		}
+		return nil
+	})
+	if err == nil {
+		// Кеш сверен с хранилищем до последнего прочитанного сообщения, снимок может начинаться с него
+		markSequenceApplied(last)
+		report.Reconciled = true
+		report.Cached = report.Matched
+		report.OnlyInChan = len(channelUIDs)
+		report.OnlyInDBSample = sampleUIDs(onlyInDB)
+		onlyInChan := make([]string, 0, len(channelUIDs))
+		for uid := range channelUIDs {
+			orderCache.Delete(uid)
+			onlyInChan = append(onlyInChan, uid)
+		}
+		report.OnlyInChanSample = sampleUIDs(onlyInChan)
+	} else {
+		// Без хранилища единственным источником остаётся канал
+		report.Error = fmt.Sprintf("сверка с хранилищем не выполнена: %v", err)
+		report.OnlyInDB = 0
+		report.Cached = report.Orders
+	}
+	report.Duration = time.Since(report.StartedAt).Round(time.Millisecond).String()
+	lastRecoveryReport.Store(report)
+	return report, nil
+}
+
+// Функция выбора отсортированных примеров order_uid для отчёта
+func sampleUIDs(uids []string) []string {
+	sort.Strings(uids)
+	if len(uids) > reportSampleSize {
+		uids = uids[:reportSampleSize]
+	}
+	return uids
+}
+
+// Функция вывода отчёта о восстановлении в журнал
+func logRecoveryReport(report *recoveryReport) {
+	log.Printf("Кеш восстановлен из канала с позиции %s: сообщений %d, некорректных %d, заказов %d, в кеше %d",
+		report.From, report.Messages, report.Invalid, report.Orders, report.Cached)
+	if !report.Reconciled {
+		log.Print(report.Error)
+		return
+	}
+	log.Printf("Сверка с хранилищем: совпадает %d, только в хранилище %d, только в канале %d",
+		report.Matched, report.OnlyInDB, report.OnlyInChan)
+	if report.OnlyInChan > 0 {
+		log.Printf("Заказы только в канале (первые %d): %v", len(report.OnlyInChanSample), report.OnlyInChanSample)
+	}
+	if report.OnlyInDB > 0 {
+		log.Printf("Заказы только в хранилище (первые %d): %v", len(report.OnlyInDBSample), report.OnlyInDBSample)
+	}
+}
+
+// Обработчик HTTP-запросов для получения отчёта о последнем восстановлении кеша из канала
+func recoveryReportHandler(w http.ResponseWriter, r *http.Request) {
+	report := lastRecoveryReport.Load()
+	if report == nil {
+		writeAPIError(w, http.StatusNotFound, apiError{Code: errCodeReportNotFound, Message: "Кеш не восстанавливался из канала"})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseReplayPosition(t *testing.T) {
+	moment := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]replayPosition{
+		"":                     {},
+		"all":                  {},
+		"42":                   {Sequence: 42},
+		"2024-05-01T12:00:00Z": {Time: moment},
+	}
+	for value, want := range cases {
+		got, err := parseReplayPosition(value)
+		if err != nil || !got.Time.Equal(want.Time) || got.Sequence != want.Sequence {
+			t.Errorf("%q: ожидалось %+v, получено %+v, ошибка %v", value, want, got, err)
+		}
+	}
+
+	got, err := parseReplayPosition("24h")
+	if err != nil || got.Sequence != 0 || time.Since(got.Time) < 24*time.Hour || time.Since(got.Time) > 25*time.Hour {
+		t.Errorf("Длительность 24h разобрана неверно: %+v, ошибка %v", got, err)
+	}
+
+	for _, value := range []string{"0", "-5", "вчера", "-1h"} {
+		if _, err := parseReplayPosition(value); err == nil {
+			t.Errorf("%q: ожидалась ошибка разбора позиции", value)
+		}
+	}
+}
+
+// Хранилище, потоковое чтение из которого завершается ошибкой
+type failingStreamRepository struct {
+	OrderRepository
+}
+
+func (failingStreamRepository) Stream(ctx context.Context, batchSize int, fn func(batch OrderBatch) error) error {
+	return errors.New("хранилище недоступно")
+}
+
+func TestReplayRangeEmpty(t *testing.T) {
+	lastTime := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		from replayPosition
+		last uint64
+		want bool
+	}{
+		{"пустой канал", replayPosition{}, 0, true},
+		{"с начала канала", replayPosition{}, 5, false},
+		{"номер за последним сообщением", replayPosition{Sequence: 6}, 5, true},
+		{"номер последнего сообщения", replayPosition{Sequence: 5}, 5, false},
+		{"время после последнего сообщения", replayPosition{Time: lastTime.Add(time.Minute)}, 5, true},
+		{"время последнего сообщения", replayPosition{Time: lastTime}, 5, false},
+		{"время до последнего сообщения", replayPosition{Time: lastTime.Add(-time.Minute)}, 5, false},
+	}
+	for _, tt := range tests {
+		if got := replayRangeEmpty(tt.from, tt.last, lastTime); got != tt.want {
+			t.Errorf("%s: ожидалось %v, получено %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRestoreCacheFromReplay(t *testing.T) {
+	useTestCache(t)
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	// Пачки из одного заказа: сообщения применяются к кешу по мере чтения канала
+	useTestConfig(t, func(cfg *Config) {
+		cfg.Restore.Source = RestoreFromReplay
+		cfg.Restore.BatchSize = 1
+	})
+
+	// В хранилище версия заказа из первого сообщения (политика ignore)
+	first := newTestOrder("replay-1")
+	r.Save(context.Background(), first, DuplicateIgnore)
+	r.Save(context.Background(), newTestOrder("replay-db-only"), DuplicateIgnore)
+
+	second := newTestOrder("replay-1")
+	second.TrackNumber = "SECOND"
+	message := func(seq uint64, order interface{}) *consumerMessage {
+		data, _ := json.Marshal(order)
+		return &consumerMessage{Sequence: seq, Data: data}
+	}
+	consumer := &fakeConsumer{replay: []*consumerMessage{
+		message(1, first),
+		message(2, second),
+		message(3, newTestOrder("replay-chan-only")),
+		{Sequence: 4, Data: []byte("не JSON")},
+	}}
+
+	report, err := restoreCacheFromReplay(context.Background(), consumer)
+	if err != nil {
+		t.Fatalf("Ошибка восстановления из канала: %v", err)
+	}
+	if report.Messages != 4 || report.Invalid != 1 || report.Orders != 2 || !report.Reconciled || report.Matched != 1 {
+		t.Errorf("Неожиданный отчёт: %+v", report)
+	}
+	if !reflect.DeepEqual(report.OnlyInDBSample, []string{"replay-db-only"}) || !reflect.DeepEqual(report.OnlyInChanSample, []string{"replay-chan-only"}) {
+		t.Errorf("Неверные расхождения: только в хранилище %v, только в канале %v", report.OnlyInDBSample, report.OnlyInChanSample)
+	}
+	if order, ok := orderCache.Get("replay-1"); !ok || order.TrackNumber != first.TrackNumber {
+		t.Errorf("В кеше должна быть версия заказа из хранилища, получено: %+v", order)
+	}
+	for _, uid := range []string{"replay-db-only", "replay-chan-only"} {
+		if _, ok := orderCache.Get(uid); ok {
+			t.Errorf("Заказ %s из одного источника не должен попадать в кеш", uid)
+		}
+	}
+	if lastRecoveryReport.Load() != report {
+		t.Error("Отчёт о восстановлении не сохранён")
+	}
+}
+
+func TestRecoveryReportHandler(t *testing.T) {
+	previous := lastRecoveryReport.Load()
+	t.Cleanup(func() { lastRecoveryReport.Store(previous) })
+
+	lastRecoveryReport.Store(nil)
+	recorder := httptest.NewRecorder()
+	recoveryReportHandler(recorder, httptest.NewRequest("GET", "/admin/recovery", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Ожидался код состояния %d, получено: %d", http.StatusNotFound, recorder.Code)
+	}
+	expectAPIError(t, recorder, errCodeReportNotFound)
+
+	lastRecoveryReport.Store(&recoveryReport{From: "all", Messages: 3})
+	recorder = httptest.NewRecorder()
+	recoveryReportHandler(recorder, httptest.NewRequest("GET", "/admin/recovery", nil))
+	var report recoveryReport
+	if err := json.NewDecoder(recorder.Body).Decode(&report); err != nil || recorder.Code != http.StatusOK || report.Messages != 3 {
+		t.Errorf("Ожидался отчёт о восстановлении, получено: код %d, %+v, %v", recorder.Code, report, err)
+	}
+}
+
+func TestRestoreCacheFromReplay_StorageUnavailable(t *testing.T) {
+	useTestCache(t)
+	useTestRepository(t, failingStreamRepository{})
+
+	data, _ := json.Marshal(newTestOrder("replay-no-db"))
+	consumer := &fakeConsumer{replay: []*consumerMessage{{Sequence: 1, Data: data}}}
+
+	report, err := restoreCacheFromReplay(context.Background(), consumer)
+	if err != nil {
+		t.Fatalf("Ошибка восстановления из канала: %v", err)
+	}
+	if report.Reconciled || report.Error == "" || report.Cached != 1 {
+		t.Errorf("Ожидался отчёт без сверки, получено: %+v", report)
+	}
+	if _, ok := orderCache.Get("replay-no-db"); !ok {
+		t.Error("Без хранилища кеш должен заполняться данными канала")
+	}
+}
+
+func TestWarmCache_ReplayFallbackToDB(t *testing.T) {
+	useTestCache(t)
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	r.Save(context.Background(), newTestOrder("replay-fallback"), DuplicateIgnore)
+	useTestConfig(t, func(cfg *Config) {
+		cfg.Snapshot.Path = ""
+		cfg.Restore.Source = RestoreFromReplay
+	})
+
+	warmCache(context.Background(), &fakeConsumer{replayErr: errors.New("канал недоступен")})
+	if _, ok := orderCache.Get("replay-fallback"); !ok {
+		t.Error("После ошибки чтения канала кеш не восстановлен из базы данных")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Ошибка, возвращаемая хранилищем, если заказ с указанным order_uid отсутствует
+var ErrOrderNotFound = errors.New("заказ не найден")
+
+// Ошибка, возвращаемая при политике reject-if-different, если повторный заказ отличается от сохранённого
+var ErrOrderConflict = errors.New("заказ с таким order_uid уже сохранён с другими данными")
+
+// Политика обработки заказа, order_uid которого уже есть в хранилище
+type DuplicatePolicy string
+
+const (
+	// Оставить сохранённый заказ без изменений
+	DuplicateIgnore DuplicatePolicy = "ignore"
+	// Заменить сохранённый заказ новыми данными
+	DuplicateReplace DuplicatePolicy = "replace"
+	// Принять повтор только если он совпадает с сохранённым заказом, иначе вернуть ErrOrderConflict
+	DuplicateRejectIfDifferent DuplicatePolicy = "reject-if-different"
+)
+
+// Результат сохранения заказа
+type SaveResult int
+
+const (
+	// Заказ сохранён впервые
+	SaveInserted SaveResult = iota
+	// Сохранённый ранее заказ заменён новыми данными
+	SaveReplaced
+	// Заказ уже был сохранён, хранилище не изменилось
+	SaveUnchanged
+)
+
+// Хранилище заказов.
+// Реализации: PostgreSQL (основная), SQLite и память (для локального запуска без сервера БД).
+type OrderRepository interface {
+	// Сохранение заказа вместе с доставкой, оплатой и товарами в одной транзакции.
+	// Повторный order_uid обрабатывается в соответствии с policy.
+	Save(ctx context.Context, order Order, policy DuplicatePolicy) (SaveResult, error)
+	// Получение полного заказа по order_uid, ErrOrderNotFound если заказа нет
+	Get(ctx context.Context, orderUID string) (Order, error)
+	// Получение заказов по набору order_uid одним запросом; отсутствующие заказы пропускаются,
+	// порядок результата не определён
+	GetMany(ctx context.Context, orderUIDs []string) ([]Order, error)
+	// Получение страницы заказов, упорядоченных по order_uid
+	List(ctx context.Context, query ListQuery) ([]Order, error)
+	// Удаление заказа со всеми связанными данными, ErrOrderNotFound если заказа нет
+	Delete(ctx context.Context, orderUID string) error
+	// Последовательное чтение всех заказов пачками по batchSize в порядке order_uid
+	Stream(ctx context.Context, batchSize int, fn func(batch OrderBatch) error) error
+	// Закрытие соединения с хранилищем
+	Close() error
+}
+
+// Параметры запроса страницы заказов
+type ListQuery struct {
+	Filter     OrderFilter
+	Sort       string   // Поле сортировки: order_uid (по умолчанию) или date_created
+	Descending bool     // Сортировка по убыванию
+	After      *listKey // Вернуть заказы, следующие за этой позицией в порядке сортировки
+	Limit      int      // Максимальное количество заказов на странице
+}
+
+// Функция получения поля сортировки с учётом значения по умолчанию
+func (q ListQuery) SortBy() string {
+	if q.Sort == "" {
+		return SortByUID
+	}
+	return q.Sort
+}
+
+// Пачка заказов, прочитанная из хранилища при потоковом чтении
+type OrderBatch struct {
+	Orders []Order // Полностью собранные заказы
+	Failed int     // Количество заказов, которые не удалось собрать
+}
+
+// Хранилище заказов, используемое приложением
+var repo OrderRepository
+
+// Функция ограничения одной операции с хранилищем временем db.query_timeout.
+// Отмена родительского контекста (например, запроса клиента) прерывает операцию раньше.
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, currentConfig().DB.QueryTimeout)
+}
+
+// Функция открытия хранилища заказов в соответствии с конфигурацией
+func openRepository(ctx context.Context, cfg *Config) (OrderRepository, error) {
+	switch cfg.Storage.Driver {
+	case "postgres":
+		r, err := newPostgresRepository(ctx, cfg.DB)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSchemaVersion(ctx, r.pool, cfg.DB.AutoMigrate); err != nil {
+			r.Close()
+			return nil, err
+		}
+		return r, nil
+	case "sqlite":
+		return newSQLiteRepository(cfg.Storage.SQLitePath)
+	case "memory":
+		return newMemoryRepository(), nil
+	default:
+		return nil, fmt.Errorf("неизвестный тип хранилища %q", cfg.Storage.Driver)
+	}
+}
+
+// Функция сравнения двух заказов, пустой и отсутствующий список товаров считаются равными
+func ordersEqual(a, b Order) bool {
+	if len(a.Items) == 0 && len(b.Items) == 0 {
+		a.Items, b.Items = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
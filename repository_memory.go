@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Хранилище заказов в памяти процесса.
+// Используется для локального запуска без сервера базы данных и в тестах.
+type memoryRepository struct {
+	mu     sync.RWMutex
+	orders map[string]Order
+}
+
+// Функция создания пустого хранилища в памяти
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{orders: make(map[string]Order)}
+}
+
+// Функция сохранения заказа с учётом политики обработки повторов
+func (r *memoryRepository) Save(ctx context.Context, order Order, policy DuplicatePolicy) (SaveResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := SaveInserted
+	if stored, ok := r.orders[order.OrderUID]; ok {
+		switch policy {
+		case DuplicateReplace:
+			result = SaveReplaced
+		case DuplicateIgnore:
+			return SaveUnchanged, nil
+		default:
+			if !ordersEqual(stored, order) {
+				return 0, ErrOrderConflict
+			}
+			return SaveUnchanged, nil
+		}
+	}
+
+	r.orders[order.OrderUID] = cloneOrder(order)
+	return result, nil
+}
+
+// Функция получения заказа по order_uid
+func (r *memoryRepository) Get(ctx context.Context, orderUID string) (Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	order, ok := r.orders[orderUID]
+	if !ok {
+		return Order{}, ErrOrderNotFound
+	}
+	return cloneOrder(order), nil
+}
+
+// Функция получения заказов по набору order_uid
+func (r *memoryRepository) GetMany(ctx context.Context, orderUIDs []string) ([]Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var orders []Order
+	for _, uid := range orderUIDs {
+		if order, ok := r.orders[uid]; ok {
+			orders = append(orders, cloneOrder(order))
+		}
+	}
+	return orders, nil
+}
+
+// Функция получения страницы заказов
+func (r *memoryRepository) List(ctx context.Context, query ListQuery) ([]Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	orders := make([]Order, 0, len(r.orders))
+	for _, order := range r.orders {
+		orders = append(orders, order)
+	}
+	page := selectOrderPage(orders, query)
+	for i := range page {
+		page[i] = cloneOrder(page[i])
+	}
+	return page, nil
+}
+
+// Функция полнотекстового поиска. Индекс строится заново при каждом запросе,
+// что приемлемо для локального запуска и тестов.
+func (r *memoryRepository) Search(ctx context.Context, query SearchQuery) ([]Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ix := newTextIndex()
+	for _, order := range r.orders {
+		ix.add(order)
+	}
+	var found []scoredOrder
+	for uid, score := range ix.search(query.Terms) {
+		found = append(found, scoredOrder{order: cloneOrder(r.orders[uid]), score: score})
+	}
+	return rankSearchResults(found, query.Limit), nil
+}
+
+// Функция удаления заказа
+func (r *memoryRepository) Delete(ctx context.Context, orderUID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.orders[orderUID]; !ok {
+		return ErrOrderNotFound
+	}
+	delete(r.orders, orderUID)
+	return nil
+}
+
+// Функция потокового чтения всех заказов пачками в порядке order_uid.
+// Список order_uid сортируется один раз в начале; заказы, удалённые во время чтения,
+// пропускаются, а добавленные после начала чтения не передаются.
+func (r *memoryRepository) Stream(ctx context.Context, batchSize int, fn func(batch OrderBatch) error) error {
+	r.mu.RLock()
+	uids := make([]string, 0, len(r.orders))
+	for uid := range r.orders {
+		uids = append(uids, uid)
+	}
+	r.mu.RUnlock()
+	sort.Strings(uids)
+	if batchSize <= 0 {
+		batchSize = max(len(uids), 1)
+	}
+
+	for start := 0; start < len(uids); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		orders, _ := r.GetMany(ctx, uids[start:min(start+batchSize, len(uids))])
+		if len(orders) == 0 {
+			continue
+		}
+		if err := fn(OrderBatch{Orders: orders}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Функция закрытия хранилища
+func (r *memoryRepository) Close() error {
+	return nil
+}
+
+// Функция копирования заказа, чтобы изменения вызывающей стороны не влияли на хранилище
+func cloneOrder(order Order) Order {
+	if order.Items != nil {
+		order.Items = append([]Item(nil), order.Items...)
+	}
+	return order
+}
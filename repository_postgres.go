@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgconn/stmtcache"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Хранилище заказов в PostgreSQL.
+// Работает через пул соединений, поэтому все методы безопасны для конкурентного вызова:
+// каждая операция берёт из пула собственное соединение, а разорванные соединения
+// пул отбрасывает и открывает заново.
+type postgresRepository struct {
+	pool *pgxpool.Pool
+}
+
+// Функция подключения к PostgreSQL.
+// При недоступности базы подключение повторяется db.connect_attempts раз с удвоением паузы.
+func newPostgresRepository(ctx context.Context, cfg DBConfig) (*postgresRepository, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.ConnString())
+	if err != nil {
+		return nil, fmt.Errorf("некорректные параметры подключения к PostgreSQL: %w", err)
+	}
+	poolConfig.MinConns = int32(cfg.MinConns)
+	poolConfig.MaxConns = int32(cfg.MaxConns)
+	poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod
+	poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+
+	// Кеш подготовленных выражений отдельный для каждого соединения пула
+	mode := stmtcache.ModePrepare
+	if cfg.StatementCacheMode == "describe" {
+		mode = stmtcache.ModeDescribe
+	}
+	capacity := cfg.StatementCacheCapacity
+	poolConfig.ConnConfig.BuildStatementCache = func(conn *pgconn.PgConn) stmtcache.Cache {
+		if capacity == 0 {
+			return nil
+		}
+		return stmtcache.New(conn, mode, capacity)
+	}
+
+	delay := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		pool, err := pgxpool.ConnectConfig(ctx, poolConfig)
+		if err == nil {
+			return &postgresRepository{pool: pool}, nil
+		}
+		if attempt >= cfg.ConnectAttempts {
+			return nil, err
+		}
+		log.Printf("Не удалось подключиться к PostgreSQL (попытка %d из %d): %v", attempt, cfg.ConnectAttempts, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// Общий интерфейс пула соединений и транзакции для выполнения запросов
+type pgxQuerier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// Запрос заказов вместе с данными о доставке и оплате.
+// LEFT JOIN позволяет обнаружить заказы, для которых не сохранились доставка или оплата.
+const selectOrdersQuery = `
+SELECT o.order_uid, o.track_number, o.entry, o.delivery_service, o.locale,
+       o.internal_signature, o.customer_id, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
+       d.order_uid IS NOT NULL,
+       COALESCE(d.name, ''), COALESCE(d.phone, ''), COALESCE(d.zip, ''), COALESCE(d.city, ''),
+       COALESCE(d.address, ''), COALESCE(d.region, ''), COALESCE(d.email, ''),
+       p.order_uid IS NOT NULL,
+       COALESCE(p.transaction, ''), COALESCE(p.request_id, ''), COALESCE(p.currency, ''),
+       COALESCE(p.provider, ''), COALESCE(p.amount, 0), COALESCE(p.payment_dt, 0),
+       COALESCE(p.bank, ''), COALESCE(p.delivery_cost, 0), COALESCE(p.goods_total, 0),
+       COALESCE(p.custom_fee, 0)
+FROM orders o
+LEFT JOIN delivery d ON d.order_uid = o.order_uid
+LEFT JOIN payment p ON p.order_uid = o.order_uid
+`
+
+// Запрос товаров для набора заказов
+const selectItemsQuery = `
+SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+FROM items
+WHERE order_uid = ANY($1)
+ORDER BY order_uid, position`
+
+// Запрос вставки заказа, при конфликте order_uid строка не изменяется
+const insertOrderQuery = `
+INSERT INTO orders (order_uid, track_number, entry, delivery_service, locale, internal_signature,
+                    customer_id, shardkey, sm_id, date_created, oof_shard)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (order_uid) DO NOTHING`
+
+// Запрос вставки или замены заказа.
+// xmax = 0 только у только что вставленной строки, что позволяет отличить вставку от обновления.
+const upsertOrderQuery = `
+INSERT INTO orders (order_uid, track_number, entry, delivery_service, locale, internal_signature,
+                    customer_id, shardkey, sm_id, date_created, oof_shard)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (order_uid) DO UPDATE SET
+    track_number = EXCLUDED.track_number, entry = EXCLUDED.entry,
+    delivery_service = EXCLUDED.delivery_service, locale = EXCLUDED.locale,
+    internal_signature = EXCLUDED.internal_signature, customer_id = EXCLUDED.customer_id,
+    shardkey = EXCLUDED.shardkey, sm_id = EXCLUDED.sm_id,
+    date_created = EXCLUDED.date_created, oof_shard = EXCLUDED.oof_shard
+RETURNING xmax = 0`
+
+// Запрос вставки или замены данных о доставке
+const upsertDeliveryQuery = `
+INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (order_uid) DO UPDATE SET
+    name = EXCLUDED.name, phone = EXCLUDED.phone, zip = EXCLUDED.zip, city = EXCLUDED.city,
+    address = EXCLUDED.address, region = EXCLUDED.region, email = EXCLUDED.email`
+
+// Запрос вставки или замены данных об оплате
+const upsertPaymentQuery = `
+INSERT INTO payment (order_uid, transaction, request_id, currency, provider, amount, payment_dt,
+                     bank, delivery_cost, goods_total, custom_fee)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ON CONFLICT (order_uid) DO UPDATE SET
+    transaction = EXCLUDED.transaction, request_id = EXCLUDED.request_id,
+    currency = EXCLUDED.currency, provider = EXCLUDED.provider, amount = EXCLUDED.amount,
+    payment_dt = EXCLUDED.payment_dt, bank = EXCLUDED.bank,
+    delivery_cost = EXCLUDED.delivery_cost, goods_total = EXCLUDED.goods_total,
+    custom_fee = EXCLUDED.custom_fee`
+
+// Запрос вставки или замены товара на указанной позиции заказа
+const upsertItemQuery = `
+INSERT INTO items (order_uid, position, chrt_id, track_number, price, rid, name, sale, size,
+                   total_price, nm_id, brand, status)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+ON CONFLICT (order_uid, position) DO UPDATE SET
+    chrt_id = EXCLUDED.chrt_id, track_number = EXCLUDED.track_number, price = EXCLUDED.price,
+    rid = EXCLUDED.rid, name = EXCLUDED.name, sale = EXCLUDED.sale, size = EXCLUDED.size,
+    total_price = EXCLUDED.total_price, nm_id = EXCLUDED.nm_id, brand = EXCLUDED.brand,
+    status = EXCLUDED.status`
+
+// Запрос обновления документа полнотекстового поиска заказа (функция orders_search_vector, миграция 0007)
+const updateSearchVectorQuery = `UPDATE orders SET search_vector = orders_search_vector(order_uid) WHERE order_uid = $1`
+
+// Функция сохранения данных заказа в базу данных.
+// Все четыре таблицы записываются через ON CONFLICT в одной транзакции,
+// поэтому повторная доставка того же заказа не приводит к ошибке первичного ключа.
+func (r *postgresRepository) Save(ctx context.Context, order Order, policy DuplicatePolicy) (SaveResult, error) {
+	// Начать транзакцию
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	// Откатить транзакцию при ошибке, после Commit откат ничего не делает
+	defer tx.Rollback(ctx)
+
+	args := []interface{}{order.OrderUID, order.TrackNumber, order.Entry, order.DeliveryService, order.Locale,
+		order.InternalSignature, order.CustomerID, order.ShardKey, order.SmID, order.DateCreated, order.OOFShard}
+
+	result := SaveInserted
+	if policy == DuplicateReplace {
+		var inserted bool
+		if err := tx.QueryRow(ctx, upsertOrderQuery, args...).Scan(&inserted); err != nil {
+			return 0, fmt.Errorf("ошибка сохранения заказа в PostgreSQL: %w", err)
+		}
+		if !inserted {
+			result = SaveReplaced
+		}
+	} else {
+		tag, err := tx.Exec(ctx, insertOrderQuery, args...)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка сохранения заказа в PostgreSQL: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return r.resolveDuplicate(ctx, tx, order, policy)
+		}
+	}
+
+	// Вставка данных в таблицу delivery
+	_, err = tx.Exec(ctx, upsertDeliveryQuery,
+		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City,
+		order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения информации о доставке в PostgreSQL: %w", err)
+	}
+
+	// Вставка данных в таблицу payment
+	_, err = tx.Exec(ctx, upsertPaymentQuery,
+		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
+		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDT, order.Payment.Bank,
+		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения информации о платеже в PostgreSQL: %w", err)
+	}
+
+	// Вставка данных в таблицу items
+	for position, item := range order.Items {
+		_, err := tx.Exec(ctx, upsertItemQuery,
+			order.OrderUID, position, item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name, item.Sale, item.Size,
+			item.TotalPrice, item.NmID, item.Brand, item.Status)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка сохранения информации о товаре в PostgreSQL: %w", err)
+		}
+	}
+	// При замене заказа удалить товары, которых нет в новой версии
+	if result == SaveReplaced {
+		_, err := tx.Exec(ctx, "DELETE FROM items WHERE order_uid = $1 AND position >= $2", order.OrderUID, len(order.Items))
+		if err != nil {
+			return 0, fmt.Errorf("ошибка удаления лишних товаров в PostgreSQL: %w", err)
+		}
+	}
+
+	// Обновить документ полнотекстового поиска по записанным товарам и доставке
+	if _, err := tx.Exec(ctx, updateSearchVectorQuery, order.OrderUID); err != nil {
+		return 0, fmt.Errorf("ошибка обновления поискового документа в PostgreSQL: %w", err)
+	}
+
+	// Подтвердить транзакцию, если все операции успешны
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return result, nil
+}
+
+// Функция обработки повторного заказа для политик ignore и reject-if-different
+func (r *postgresRepository) resolveDuplicate(ctx context.Context, tx pgx.Tx, order Order, policy DuplicatePolicy) (SaveResult, error) {
+	if policy == DuplicateIgnore {
+		return SaveUnchanged, nil
+	}
+
+	stored, failed, _, err := r.queryOrders(ctx, tx, "WHERE o.order_uid = $1", order.OrderUID)
+	if err != nil {
+		return 0, err
+	}
+	if failed > 0 || len(stored) == 0 || !ordersEqual(stored[0], order) {
+		return 0, ErrOrderConflict
+	}
+	return SaveUnchanged, nil
+}
+
+// Функция получения заказа по order_uid
+func (r *postgresRepository) Get(ctx context.Context, orderUID string) (Order, error) {
+	orders, failed, _, err := r.queryOrders(ctx, r.pool, "WHERE o.order_uid = $1", orderUID)
+	if err != nil {
+		return Order{}, err
+	}
+	if failed > 0 {
+		return Order{}, fmt.Errorf("заказ %s сохранён не полностью", orderUID)
+	}
+	if len(orders) == 0 {
+		return Order{}, ErrOrderNotFound
+	}
+	return orders[0], nil
+}
+
+// Функция получения заказов по набору order_uid
+func (r *postgresRepository) GetMany(ctx context.Context, orderUIDs []string) ([]Order, error) {
+	orders, failed, _, err := r.queryOrders(ctx, r.pool, "WHERE o.order_uid = ANY($1)", orderUIDs)
+	if err == nil && failed > 0 {
+		log.Printf("При получении набора заказов пропущено сохранённых не полностью: %d", failed)
+	}
+	return orders, err
+}
+
+// Сравнение order_uid в порядке байтов. Правило сравнения базы по умолчанию зависит от локали
+// (например en_US.UTF-8 не учитывает регистр и знаки препинания на первом проходе), и страницы
+// из базы расходились бы со страницами из кеша для одного курсора. Индексы с тем же правилом
+// созданы миграцией 0009.
+const postgresOrderUID = `o.order_uid COLLATE "C"`
+
+// Диалект запроса списка заказов для PostgreSQL. Функция orders_created_at (миграции 0005, 0008)
+// возвращает NULL для некорректной даты и покрыта индексом вместе с order_uid.
+var postgresListDialect = listDialect{
+	placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	uid:         postgresOrderUID,
+	created:     "orders_created_at(o.date_created)",
+	createdArg:  func(ph string) string { return ph + "::timestamptz" },
+	timeArg:     func(t time.Time) interface{} { return t },
+}
+
+// Функция получения страницы заказов
+func (r *postgresRepository) List(ctx context.Context, query ListQuery) ([]Order, error) {
+	where, args := buildListQuery(query, postgresListDialect)
+	orders, _, _, err := r.queryOrders(ctx, r.pool, where, args...)
+	return orders, err
+}
+
+// Функция полнотекстового поиска по документу search_vector.
+// Релевантность вычисляет ts_rank с весами полей по умолчанию, которые совпадают с весами поиска в кеше.
+func (r *postgresRepository) Search(ctx context.Context, query SearchQuery) ([]Order, error) {
+	orders, _, _, err := r.queryOrders(ctx, r.pool,
+		"CROSS JOIN to_tsquery('simple', $1) q WHERE o.search_vector @@ q ORDER BY ts_rank(o.search_vector, q) DESC, "+postgresOrderUID+" LIMIT $2",
+		searchTSQuery(query.Terms), query.Limit)
+	return orders, err
+}
+
+// Функция удаления заказа со всеми связанными данными
+func (r *postgresRepository) Delete(ctx context.Context, orderUID string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range []string{"items", "payment", "delivery"} {
+		if _, err := tx.Exec(ctx, "DELETE FROM "+table+" WHERE order_uid = $1", orderUID); err != nil {
+			return fmt.Errorf("ошибка удаления из таблицы %s: %w", table, err)
+		}
+	}
+	tag, err := tx.Exec(ctx, "DELETE FROM orders WHERE order_uid = $1", orderUID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления заказа: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOrderNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return nil
+}
+
+// Функция потокового чтения всех заказов.
+// Заказы читаются пачками с пагинацией по order_uid, поэтому в памяти находится только одна пачка.
+func (r *postgresRepository) Stream(ctx context.Context, batchSize int, fn func(batch OrderBatch) error) error {
+	lastUID := ""
+	for {
+		orders, failed, nextUID, err := r.queryOrders(ctx, r.pool, "WHERE "+postgresOrderUID+" > $1 ORDER BY "+postgresOrderUID+" LIMIT $2", lastUID, batchSize)
+		if err != nil {
+			return err
+		}
+		if nextUID == "" {
+			return nil
+		}
+
+		if err := fn(OrderBatch{Orders: orders, Failed: failed}); err != nil {
+			return err
+		}
+
+		lastUID = nextUID
+		if len(orders)+failed < batchSize {
+			return nil
+		}
+	}
+}
+
+// Функция закрытия пула соединений с базой данных
+func (r *postgresRepository) Close() error {
+	r.pool.Close()
+	return nil
+}
+
+// Функция выборки заказов с указанным условием.
+// Возвращает собранные заказы, количество заказов, которые не удалось собрать,
+// и последний прочитанный order_uid (пустой, если строк нет) для запроса следующей пачки.
+func (r *postgresRepository) queryOrders(ctx context.Context, q pgxQuerier, where string, args ...interface{}) ([]Order, int, string, error) {
+	rows, err := q.Query(ctx, selectOrdersQuery+where, args...)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("ошибка запроса заказов из PostgreSQL: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
+	failed := 0
+	lastUID := ""
+	for rows.Next() {
+		var order Order
+		var hasDelivery, hasPayment bool
+		err := rows.Scan(
+			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.DeliveryService, &order.Locale,
+			&order.InternalSignature, &order.CustomerID, &order.ShardKey, &order.SmID, &order.DateCreated, &order.OOFShard,
+			&hasDelivery,
+			&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip, &order.Delivery.City,
+			&order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email,
+			&hasPayment,
+			&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency,
+			&order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDT,
+			&order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal,
+			&order.Payment.CustomFee,
+		)
+		if err != nil {
+			// После ошибки сканирования pgx закрывает выборку, продолжить чтение невозможно
+			return nil, failed, lastUID, fmt.Errorf("ошибка сканирования строки заказа после %q: %w", lastUID, err)
+		}
+		lastUID = order.OrderUID
+		if !hasDelivery || !hasPayment {
+			log.Printf("Заказ %s пропущен: отсутствуют данные о доставке (%t) или оплате (%t)", order.OrderUID, hasDelivery, hasPayment)
+			failed++
+			continue
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, failed, lastUID, fmt.Errorf("ошибка чтения заказов из PostgreSQL: %w", err)
+	}
+	if len(orders) == 0 {
+		return nil, failed, lastUID, nil
+	}
+
+	if err := r.attachItems(ctx, q, orders); err != nil {
+		return nil, failed, lastUID, err
+	}
+
+	return orders, failed, lastUID, nil
+}
+
+// Функция загрузки товаров для набора заказов
+func (r *postgresRepository) attachItems(ctx context.Context, q pgxQuerier, orders []Order) error {
+	uids := make([]string, len(orders))
+	index := make(map[string]int, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+		index[order.OrderUID] = i
+	}
+
+	rows, err := q.Query(ctx, selectItemsQuery, uids)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса товаров из PostgreSQL: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderUID string
+		var item Item
+		err := rows.Scan(&orderUID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.RID, &item.Name,
+			&item.Sale, &item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status)
+		if err != nil {
+			return fmt.Errorf("ошибка сканирования товара заказа %s: %w", orderUID, err)
+		}
+		i := index[orderUID]
+		orders[i].Items = append(orders[i].Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка чтения товаров из PostgreSQL: %w", err)
+	}
+
+	return nil
+}
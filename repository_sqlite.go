@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Количество заказов, просматриваемых за один запрос при поиске в SQLite
+const searchScanBatchSize = 500
+
+// Хранилище заказов в файле SQLite.
+// Позволяет запустить весь конвейер локально без сервера базы данных.
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+// Схема базы SQLite, повторяющая таблицы PostgreSQL
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS orders (
+	order_uid          TEXT PRIMARY KEY,
+	track_number       TEXT NOT NULL,
+	entry              TEXT NOT NULL,
+	delivery_service   TEXT NOT NULL,
+	locale             TEXT NOT NULL,
+	internal_signature TEXT NOT NULL,
+	customer_id        TEXT NOT NULL,
+	shardkey           TEXT NOT NULL,
+	sm_id              INTEGER NOT NULL,
+	date_created       TEXT NOT NULL,
+	oof_shard          TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS delivery (
+	order_uid TEXT PRIMARY KEY REFERENCES orders (order_uid) ON DELETE CASCADE,
+	name      TEXT NOT NULL,
+	phone     TEXT NOT NULL,
+	zip       TEXT NOT NULL,
+	city      TEXT NOT NULL,
+	address   TEXT NOT NULL,
+	region    TEXT NOT NULL,
+	email     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS payment (
+	order_uid     TEXT PRIMARY KEY REFERENCES orders (order_uid) ON DELETE CASCADE,
+	"transaction" TEXT NOT NULL,
+	request_id    TEXT NOT NULL,
+	currency      TEXT NOT NULL,
+	provider      TEXT NOT NULL,
+	amount        REAL NOT NULL,
+	payment_dt    INTEGER NOT NULL,
+	bank          TEXT NOT NULL,
+	delivery_cost REAL NOT NULL,
+	goods_total   REAL NOT NULL,
+	custom_fee    REAL NOT NULL
+);
+CREATE TABLE IF NOT EXISTS items (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_uid    TEXT NOT NULL REFERENCES orders (order_uid) ON DELETE CASCADE,
+	position     INTEGER NOT NULL,
+	chrt_id      INTEGER NOT NULL,
+	track_number TEXT NOT NULL,
+	price        REAL NOT NULL,
+	rid          TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	sale         INTEGER NOT NULL,
+	size         TEXT NOT NULL,
+	total_price  REAL NOT NULL,
+	nm_id        INTEGER NOT NULL,
+	brand        TEXT NOT NULL,
+	status       INTEGER NOT NULL,
+	UNIQUE (order_uid, position)
+);
+CREATE TABLE IF NOT EXISTS dead_letters (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	subject    TEXT NOT NULL,
+	sequence   INTEGER NOT NULL,
+	payload    BLOB NOT NULL,
+	error      TEXT NOT NULL,
+	details    TEXT,
+	attempts   INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS orders_track_number_idx ON orders (track_number);
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id, order_uid);
+CREATE INDEX IF NOT EXISTS payment_transaction_idx ON payment ("transaction");
+`
+
+// Запрос заказов вместе с данными о доставке и оплате
+const sqliteSelectOrdersQuery = `
+SELECT o.order_uid, o.track_number, o.entry, o.delivery_service, o.locale,
+       o.internal_signature, o.customer_id, o.shardkey, o.sm_id, o.date_created, o.oof_shard,
+       d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+       p."transaction", p.request_id, p.currency, p.provider, p.amount, p.payment_dt,
+       p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+FROM orders o
+JOIN delivery d ON d.order_uid = o.order_uid
+JOIN payment p ON p.order_uid = o.order_uid
+`
+
+// Диалект запроса списка заказов для SQLite. Момент создания приводится strftime к тексту в UTC
+// с миллисекундами, который сравнивается в хронологическом порядке; некорректная дата даёт NULL.
+var sqliteListDialect = listDialect{
+	placeholder: func(n int) string { return "?" },
+	uid:         "o.order_uid", // Правило сравнения BINARY по умолчанию сравнивает байты
+	created:     "strftime('%Y-%m-%d %H:%M:%f', o.date_created)",
+	createdArg:  func(ph string) string { return "strftime('%Y-%m-%d %H:%M:%f', " + ph + ")" },
+	timeArg:     func(t time.Time) interface{} { return t.UTC().Format(time.RFC3339Nano) },
+}
+
+// Функция открытия (и при необходимости создания) базы SQLite
+func newSQLiteRepository(path string) (*sqliteRepository, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite допускает только одного писателя, поэтому ограничиваем пул одним соединением
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ошибка создания схемы SQLite: %w", err)
+	}
+	return &sqliteRepository{db: db}, nil
+}
+
+// Функция сохранения заказа.
+// Как и в PostgreSQL, все таблицы записываются через ON CONFLICT в одной транзакции.
+func (r *sqliteRepository) Save(ctx context.Context, order Order, policy DuplicatePolicy) (SaveResult, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM orders WHERE order_uid = ?)", order.OrderUID).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("ошибка проверки заказа в SQLite: %w", err)
+	}
+	result := SaveInserted
+	if exists {
+		switch policy {
+		case DuplicateReplace:
+			result = SaveReplaced
+		case DuplicateIgnore:
+			return SaveUnchanged, nil
+		default:
+			stored, err := r.queryOrders(ctx, tx, "WHERE o.order_uid = ?", order.OrderUID)
+			if err != nil {
+				return 0, err
+			}
+			if len(stored) == 0 || !ordersEqual(stored[0], order) {
+				return 0, ErrOrderConflict
+			}
+			return SaveUnchanged, nil
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+INSERT INTO orders (order_uid, track_number, entry, delivery_service, locale, internal_signature,
+                    customer_id, shardkey, sm_id, date_created, oof_shard)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (order_uid) DO UPDATE SET
+    track_number = excluded.track_number, entry = excluded.entry,
+    delivery_service = excluded.delivery_service, locale = excluded.locale,
+    internal_signature = excluded.internal_signature, customer_id = excluded.customer_id,
+    shardkey = excluded.shardkey, sm_id = excluded.sm_id,
+    date_created = excluded.date_created, oof_shard = excluded.oof_shard`,
+		order.OrderUID, order.TrackNumber, order.Entry, order.DeliveryService, order.Locale,
+		order.InternalSignature, order.CustomerID, order.ShardKey, order.SmID, order.DateCreated, order.OOFShard)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения заказа в SQLite: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (order_uid) DO UPDATE SET
+    name = excluded.name, phone = excluded.phone, zip = excluded.zip, city = excluded.city,
+    address = excluded.address, region = excluded.region, email = excluded.email`,
+		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City,
+		order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения информации о доставке в SQLite: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+INSERT INTO payment (order_uid, "transaction", request_id, currency, provider, amount, payment_dt,
+                     bank, delivery_cost, goods_total, custom_fee)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (order_uid) DO UPDATE SET
+    "transaction" = excluded."transaction", request_id = excluded.request_id,
+    currency = excluded.currency, provider = excluded.provider, amount = excluded.amount,
+    payment_dt = excluded.payment_dt, bank = excluded.bank,
+    delivery_cost = excluded.delivery_cost, goods_total = excluded.goods_total,
+    custom_fee = excluded.custom_fee`,
+		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
+		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDT, order.Payment.Bank,
+		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка сохранения информации о платеже в SQLite: %w", err)
+	}
+
+	for position, item := range order.Items {
+		_, err := tx.ExecContext(ctx, `
+INSERT INTO items (order_uid, position, chrt_id, track_number, price, rid, name, sale, size,
+                   total_price, nm_id, brand, status)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (order_uid, position) DO UPDATE SET
+    chrt_id = excluded.chrt_id, track_number = excluded.track_number, price = excluded.price,
+    rid = excluded.rid, name = excluded.name, sale = excluded.sale, size = excluded.size,
+    total_price = excluded.total_price, nm_id = excluded.nm_id, brand = excluded.brand,
+    status = excluded.status`,
+			order.OrderUID, position, item.ChrtID, item.TrackNumber, item.Price, item.RID, item.Name, item.Sale, item.Size,
+			item.TotalPrice, item.NmID, item.Brand, item.Status)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка сохранения информации о товаре в SQLite: %w", err)
+		}
+	}
+	if result == SaveReplaced {
+		_, err := tx.ExecContext(ctx, "DELETE FROM items WHERE order_uid = ? AND position >= ?", order.OrderUID, len(order.Items))
+		if err != nil {
+			return 0, fmt.Errorf("ошибка удаления лишних товаров в SQLite: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка подтверждения транзакции: %w", err)
+	}
+	return result, nil
+}
+
+// Функция получения заказа по order_uid
+func (r *sqliteRepository) Get(ctx context.Context, orderUID string) (Order, error) {
+	orders, err := r.queryOrders(ctx, r.db, "WHERE o.order_uid = ?", orderUID)
+	if err != nil {
+		return Order{}, err
+	}
+	if len(orders) == 0 {
+		return Order{}, ErrOrderNotFound
+	}
+	return orders[0], nil
+}
+
+// Функция получения заказов по набору order_uid
+func (r *sqliteRepository) GetMany(ctx context.Context, orderUIDs []string) ([]Order, error) {
+	if len(orderUIDs) == 0 {
+		return nil, nil
+	}
+	placeholders := make([]string, len(orderUIDs))
+	args := make([]interface{}, len(orderUIDs))
+	for i, uid := range orderUIDs {
+		placeholders[i] = "?"
+		args[i] = uid
+	}
+	return r.queryOrders(ctx, r.db, "WHERE o.order_uid IN ("+strings.Join(placeholders, ", ")+")", args...)
+}
+
+// Функция получения страницы заказов
+func (r *sqliteRepository) List(ctx context.Context, query ListQuery) ([]Order, error) {
+	where, args := buildListQuery(query, sqliteListDialect)
+	return r.queryOrders(ctx, r.db, where, args...)
+}
+
+// Функция удаления заказа, связанные строки удаляются каскадно
+func (r *sqliteRepository) Delete(ctx context.Context, orderUID string) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM orders WHERE order_uid = ?", orderUID)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления заказа: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
+}
+
+// Функция потокового чтения всех заказов пачками
+func (r *sqliteRepository) Stream(ctx context.Context, batchSize int, fn func(batch OrderBatch) error) error {
+	lastUID := ""
+	for {
+		orders, err := r.List(ctx, ListQuery{After: &listKey{UID: lastUID}, Limit: batchSize})
+		if err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+		if err := fn(OrderBatch{Orders: orders}); err != nil {
+			return err
+		}
+		lastUID = orders[len(orders)-1].OrderUID
+	}
+}
+
+// Функция полнотекстового поиска. Полнотекстовый индекс SQLite не разбирает слова так же,
+// как кеш и PostgreSQL, поэтому заказы читаются пачками по searchScanBatchSize и проверяются
+// тем же индексом, что и в кеше; в памяти остаются не более query.Limit лучших заказов.
+// Поиск просматривает все заказы, что приемлемо для локального запуска.
+func (r *sqliteRepository) Search(ctx context.Context, query SearchQuery) ([]Order, error) {
+	var found []scoredOrder
+	err := r.Stream(ctx, searchScanBatchSize, func(batch OrderBatch) error {
+		ix := newTextIndex()
+		byUID := make(map[string]Order, len(batch.Orders))
+		for _, order := range batch.Orders {
+			ix.add(order)
+			byUID[order.OrderUID] = order
+		}
+		// Релевантность зависит только от самого заказа, поэтому пачки ранжируются независимо
+		for uid, score := range ix.search(query.Terms) {
+			found = append(found, scoredOrder{order: byUID[uid], score: score})
+		}
+		found = topSearchResults(found, query.Limit)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rankSearchResults(found, query.Limit), nil
+}
+
+// Функция закрытия базы
+func (r *sqliteRepository) Close() error {
+	return r.db.Close()
+}
+
+// Общий интерфейс базы и транзакции для выполнения запросов
+type sqlQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Функция выборки заказов с указанным условием вместе с товарами
+func (r *sqliteRepository) queryOrders(ctx context.Context, q sqlQuerier, where string, args ...interface{}) ([]Order, error) {
+	rows, err := q.QueryContext(ctx, sqliteSelectOrdersQuery+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса заказов из SQLite: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		var order Order
+		err := rows.Scan(
+			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.DeliveryService, &order.Locale,
+			&order.InternalSignature, &order.CustomerID, &order.ShardKey, &order.SmID, &order.DateCreated, &order.OOFShard,
+			&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip, &order.Delivery.City,
+			&order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email,
+			&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency,
+			&order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDT,
+			&order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal,
+			&order.Payment.CustomFee,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сканирования строки заказа: %w", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения заказов из SQLite: %w", err)
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+
+	if err := r.attachItems(ctx, q, orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// Функция загрузки товаров для набора заказов
+func (r *sqliteRepository) attachItems(ctx context.Context, q sqlQuerier, orders []Order) error {
+	placeholders := make([]string, len(orders))
+	args := make([]interface{}, len(orders))
+	index := make(map[string]int, len(orders))
+	for i, order := range orders {
+		placeholders[i] = "?"
+		args[i] = order.OrderUID
+		index[order.OrderUID] = i
+	}
+
+	rows, err := q.QueryContext(ctx, `
+SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+FROM items
+WHERE order_uid IN (`+strings.Join(placeholders, ", ")+`)
+ORDER BY order_uid, position`, args...)
+	if err != nil {
+		return fmt.Errorf("ошибка запроса товаров из SQLite: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderUID string
+		var item Item
+		err := rows.Scan(&orderUID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.RID, &item.Name,
+			&item.Sale, &item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status)
+		if err != nil {
+			return fmt.Errorf("ошибка сканирования товара заказа %s: %w", orderUID, err)
+		}
+		i := index[orderUID]
+		orders[i].Items = append(orders[i].Items, item)
+	}
+	return rows.Err()
+}
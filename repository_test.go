@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Функция создания тестового заказа с указанным order_uid
+func newTestOrder(uid string) Order {
+	return Order{
+		OrderUID:    uid,
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: Payment{
+			Transaction:  uid,
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDT:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []Item{
+			{
+				ChrtID:      9934930,
+				TrackNumber: "WBILMTESTTRACK",
+				Price:       453,
+				RID:         "ab4219087a764ae0btest",
+				Name:        "Mascaras",
+				Sale:        30,
+				Size:        "0",
+				TotalPrice:  317,
+				NmID:        2389212,
+				Brand:       "Vivienne Sabo",
+				Status:      202,
+			},
+		},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		ShardKey:        "9",
+		SmID:            99,
+		DateCreated:     "2021-11-26T06:22:19Z",
+		OOFShard:        "1",
+	}
+}
+
+// Общие проверки поведения для всех реализаций хранилища
+func testOrderRepository(t *testing.T, repo OrderRepository) {
+	ctx := context.Background()
+
+	for _, uid := range []string{"b", "a", "c"} {
+		if _, err := repo.Save(ctx, newTestOrder(uid), DuplicateIgnore); err != nil {
+			t.Fatalf("Ошибка сохранения заказа %s: %v", uid, err)
+		}
+	}
+
+	// Повторная доставка при каждой политике
+	changed := newTestOrder("a")
+	changed.Delivery.City = "Moscow"
+	changed.Items = append(changed.Items, changed.Items[0])
+
+	if result, err := repo.Save(ctx, changed, DuplicateIgnore); err != nil || result != SaveUnchanged {
+		t.Errorf("ignore: ожидался SaveUnchanged без ошибки, получено: %v, %v", result, err)
+	}
+	if result, err := repo.Save(ctx, newTestOrder("a"), DuplicateRejectIfDifferent); err != nil || result != SaveUnchanged {
+		t.Errorf("reject-if-different: ожидался SaveUnchanged для одинакового заказа, получено: %v, %v", result, err)
+	}
+	if _, err := repo.Save(ctx, changed, DuplicateRejectIfDifferent); !errors.Is(err, ErrOrderConflict) {
+		t.Errorf("reject-if-different: ожидалась ошибка ErrOrderConflict, получено: %v", err)
+	}
+	if result, err := repo.Save(ctx, changed, DuplicateReplace); err != nil || result != SaveReplaced {
+		t.Errorf("replace: ожидался SaveReplaced без ошибки, получено: %v, %v", result, err)
+	}
+	if got, _ := repo.Get(ctx, "a"); !reflect.DeepEqual(got, changed) {
+		t.Errorf("replace: заказ не заменён:\n%+v\n%+v", got, changed)
+	}
+	// Возврат к исходной версии удаляет лишний товар
+	if result, err := repo.Save(ctx, newTestOrder("a"), DuplicateReplace); err != nil || result != SaveReplaced {
+		t.Errorf("replace: ожидался SaveReplaced без ошибки, получено: %v, %v", result, err)
+	}
+
+	got, err := repo.Get(ctx, "a")
+	if err != nil {
+		t.Fatalf("Ошибка получения заказа: %v", err)
+	}
+	if !reflect.DeepEqual(got, newTestOrder("a")) {
+		t.Errorf("Полученный заказ отличается от сохранённого:\n%+v\n%+v", got, newTestOrder("a"))
+	}
+
+	if _, err := repo.Get(ctx, "missing"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Ожидалась ошибка ErrOrderNotFound, получено: %v", err)
+	}
+
+	many, err := repo.GetMany(ctx, []string{"c", "missing", "a"})
+	if err != nil {
+		t.Fatalf("Ошибка получения набора заказов: %v", err)
+	}
+	sort.Slice(many, func(i, j int) bool { return many[i].OrderUID < many[j].OrderUID })
+	if len(many) != 2 || !reflect.DeepEqual(many[0], newTestOrder("a")) || !reflect.DeepEqual(many[1], newTestOrder("c")) {
+		t.Errorf("Ожидались полные заказы a и c, получено: %+v", many)
+	}
+
+	page, err := repo.List(ctx, ListQuery{After: &listKey{UID: "a"}, Limit: 1})
+	if err != nil {
+		t.Fatalf("Ошибка получения страницы заказов: %v", err)
+	}
+	if len(page) != 1 || page[0].OrderUID != "b" {
+		t.Errorf("Ожидалась страница с заказом b, получено: %+v", page)
+	}
+
+	var streamed []string
+	err = repo.Stream(ctx, 2, func(batch OrderBatch) error {
+		for _, order := range batch.Orders {
+			streamed = append(streamed, order.OrderUID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Ошибка потокового чтения заказов: %v", err)
+	}
+	if !reflect.DeepEqual(streamed, []string{"a", "b", "c"}) {
+		t.Errorf("Ожидались заказы [a b c], получено: %v", streamed)
+	}
+
+	if err := repo.Delete(ctx, "b"); err != nil {
+		t.Fatalf("Ошибка удаления заказа: %v", err)
+	}
+	if _, err := repo.Get(ctx, "b"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Удалённый заказ всё ещё доступен: %v", err)
+	}
+	if err := repo.Delete(ctx, "b"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("Ожидалась ошибка ErrOrderNotFound при повторном удалении, получено: %v", err)
+	}
+}
+
+func TestMemoryRepository(t *testing.T) {
+	testOrderRepository(t, newMemoryRepository())
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	repo, err := newSQLiteRepository(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Ошибка открытия SQLite: %v", err)
+	}
+	defer repo.Close()
+
+	testOrderRepository(t, repo)
+}
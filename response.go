@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Повторно используемые компрессоры: gzip.NewWriter выделяет сотни килобайт под окно
+// и таблицы, и создание его на каждое добавление в кеш стоило дороже самого сжатия
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// Заказ в готовом для ответа виде. Создаётся один раз при добавлении в кеш и больше не изменяется,
+// поэтому ответ на запрос сводится к записи готовых байтов.
+type encodedOrder struct {
+	JSON []byte // Каноническое представление заказа в JSON
+	Gzip []byte // Сжатое представление, nil если сжатие отключено или тело слишком короткое
+	ETag string // Строгий ETag несжатого представления, вычисленный по JSON
+
+	// Строгий ETag сжатого представления. Представления различаются побайтно,
+	// поэтому по RFC 9110 у них должны быть разные строгие ETag.
+	GzipETag string
+}
+
+// Функция кодирования заказа для ответа.
+// Тело сжимается, если gzipMinSize неотрицателен и длина JSON не меньше gzipMinSize.
+func encodeOrder(order Order, gzipMinSize int) (*encodedOrder, error) {
+	// json.Encoder добавляет перевод строки, как и прежний ответ обработчика
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(order); err != nil {
+		return nil, err
+	}
+	encoded := &encodedOrder{JSON: buf.Bytes()}
+
+	h := fnv.New64a()
+	h.Write(encoded.JSON)
+	sum := h.Sum64()
+	encoded.ETag = fmt.Sprintf(`"%016x"`, sum)
+
+	if gzipMinSize >= 0 && len(encoded.JSON) >= gzipMinSize {
+		var compressed bytes.Buffer
+		zw := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(zw)
+		zw.Reset(&compressed)
+		zw.Write(encoded.JSON)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		encoded.Gzip = compressed.Bytes()
+		encoded.GzipETag = fmt.Sprintf(`"%016x-gzip"`, sum)
+	}
+	return encoded, nil
+}
+
+// Приблизительный объём памяти, занимаемый закодированными представлениями
+func (e *encodedOrder) size() int64 {
+	return int64(len(e.JSON) + len(e.Gzip) + len(e.ETag) + len(e.GzipETag))
+}
+
+// Функция записи закодированного заказа в ответ.
+// Сжатое представление отдаётся клиентам, принимающим gzip. Если ETag выбранного
+// представления совпадает с If-None-Match, возвращается 304 без тела.
+func writeEncodedOrder(w http.ResponseWriter, r *http.Request, encoded *encodedOrder) {
+	header := w.Header()
+	body, etag := encoded.JSON, encoded.ETag
+	gzipped := encoded.Gzip != nil && acceptsGzip(r.Header.Get("Accept-Encoding"))
+	if gzipped {
+		body, etag = encoded.Gzip, encoded.GzipETag
+	}
+	header.Set("ETag", etag)
+	header.Set("Vary", "Accept-Encoding")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Type", "application/json")
+	if gzipped {
+		header.Set("Content-Encoding", "gzip")
+	}
+	// Для HEAD тело не передаётся, но заголовки совпадают с ответом на GET
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(body)
+}
+
+// Функция проверки заголовка If-None-Match: список ETag через запятую или "*".
+// Сравнение слабое, как требует RFC 9110 для If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Функция проверки, что клиент принимает ответы, сжатые gzip
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		// Явный отказ: gzip;q=0
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
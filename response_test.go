@@ -0,0 +1,104 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetOrderHandler_ETagAndGzip(t *testing.T) {
+	useTestRepository(t, newMemoryRepository())
+	previous := orderCache
+	orderCache = newOrderCache(CacheConfig{Policy: EvictLRU, Shards: 1, GzipMinSize: 0})
+	defer func() { orderCache = previous }()
+	order := newTestOrder("etag-order")
+	orderCache.Set(order)
+
+	recorder := httptest.NewRecorder()
+	getOrderHandler(recorder, httptest.NewRequest("GET", "/order?id="+order.OrderUID, nil))
+	etag := recorder.Header().Get("ETag")
+	if recorder.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Ожидался ответ 200 с ETag, получено: %d, %q", recorder.Code, etag)
+	}
+
+	// Совпадающий If-None-Match возвращает 304 без тела
+	req := httptest.NewRequest("GET", "/order?id="+order.OrderUID, nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	recorder = httptest.NewRecorder()
+	getOrderHandler(recorder, req)
+	if recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 {
+		t.Errorf("Ожидался ответ 304 без тела, получено: %d, %q", recorder.Code, recorder.Body)
+	}
+
+	// Клиенту, принимающему gzip, отдаётся сжатое представление
+	req = httptest.NewRequest("GET", "/order?id="+order.OrderUID, nil)
+	req.Header.Set("Accept-Encoding", "br, gzip;q=0.8")
+	recorder = httptest.NewRecorder()
+	getOrderHandler(recorder, req)
+	if recorder.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Ожидался ответ, сжатый gzip, заголовки: %v", recorder.Header())
+	}
+	gzipETag := recorder.Header().Get("ETag")
+	if gzipETag == "" || gzipETag == etag {
+		t.Errorf("Ожидался отдельный ETag сжатого представления, получено: %q и %q", gzipETag, etag)
+	}
+	zr, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatalf("Ошибка чтения сжатого ответа: %v", err)
+	}
+	data, _ := io.ReadAll(zr)
+	var decoded Order
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.OrderUID != order.OrderUID {
+		t.Errorf("Ожидался заказ %s в сжатом ответе, получено: %+v, %v", order.OrderUID, decoded, err)
+	}
+
+	// ETag несжатого представления не подтверждает сжатое, и наоборот
+	for _, tt := range []struct {
+		acceptEncoding, ifNoneMatch string
+		want                        int
+	}{
+		{"gzip", gzipETag, http.StatusNotModified},
+		{"gzip", etag, http.StatusOK},
+		{"", gzipETag, http.StatusOK},
+	} {
+		req = httptest.NewRequest("GET", "/order?id="+order.OrderUID, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		req.Header.Set("If-None-Match", tt.ifNoneMatch)
+		recorder = httptest.NewRecorder()
+		getOrderHandler(recorder, req)
+		if recorder.Code != tt.want {
+			t.Errorf("Accept-Encoding %q, If-None-Match %s: ожидался ответ %d, получено: %d",
+				tt.acceptEncoding, tt.ifNoneMatch, tt.want, recorder.Code)
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                   false,
+		"gzip":               true,
+		"deflate, gzip":      true,
+		"gzip;q=0":           false,
+		"gzip; q=0.5":        true,
+		"br":                 false,
+		"identity, gzip;q=1": true,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, ожидалось %v", header, got, want)
+		}
+	}
+}
+
+func BenchmarkEncodeOrder(b *testing.B) {
+	order := newTestOrder("bench-encode")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := encodeOrder(order, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
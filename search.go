@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Поля заказа, по которым выполняется полнотекстовый поиск
+type SearchField int
+
+const (
+	SearchBrand     SearchField = iota // items[].brand
+	SearchItemName                     // items[].name
+	SearchRecipient                    // delivery.name
+	SearchCity                         // delivery.city
+	searchFieldCount
+)
+
+// Имена полей для ограничения поиска в запросе, например brand:Nike
+var searchFieldNames = [searchFieldCount]string{
+	SearchBrand:     "brand",
+	SearchItemName:  "name",
+	SearchRecipient: "recipient",
+	SearchCity:      "city",
+}
+
+// Вес совпадения в каждом поле. Значения равны весам A, B, C, D по умолчанию функции ts_rank
+// в PostgreSQL, где поля документа заказа помечены теми же буквами (миграция 0007).
+// Сама релевантность считается по другой формуле (см. textIndex.search), поэтому
+// порядок найденных заказов в кеше и в PostgreSQL может различаться.
+var searchFieldWeights = [searchFieldCount]float64{
+	SearchBrand:     1.0,
+	SearchItemName:  0.4,
+	SearchRecipient: 0.2,
+	SearchCity:      0.1,
+}
+
+// Метки весов полей в документе tsvector
+var searchFieldLabels = [searchFieldCount]string{
+	SearchBrand:     "A",
+	SearchItemName:  "B",
+	SearchRecipient: "C",
+	SearchCity:      "D",
+}
+
+// Множитель веса для совпадения только по префиксу слова
+const searchPrefixFactor = 0.5
+
+// Максимальное количество слов в поисковом запросе
+const maxSearchTerms = 10
+
+// Слово поискового запроса. Слово совпадает со словами поля, которые начинаются с Token.
+type SearchTerm struct {
+	Token  string
+	Field  SearchField
+	Scoped bool // Искать только в поле Field, иначе во всех полях
+}
+
+// Поисковый запрос: заказ должен содержать все слова запроса
+type SearchQuery struct {
+	Terms []SearchTerm
+	Limit int
+}
+
+// Хранилище, поддерживающее полнотекстовый поиск по всем заказам (PostgreSQL, SQLite и память).
+// Заказы возвращаются в порядке убывания релевантности, при равной релевантности - по order_uid.
+// SQLite и память ищут так же, как кеш; PostgreSQL разбивает текст на слова и считает
+// релевантность по-своему (см. searchTokens и textIndex.search).
+type OrderSearcher interface {
+	Search(ctx context.Context, query SearchQuery) ([]Order, error)
+}
+
+// Функция разбора поискового запроса.
+// Слова разделяются пробелами; префикс поле: ограничивает поиск одним полем (brand:Nike).
+// Слова приводятся к нижнему регистру и разбиваются по символам, не являющимся буквами и цифрами,
+// так же, как текст заказов при индексации.
+func parseSearchQuery(q string) (SearchQuery, error) {
+	var query SearchQuery
+	for _, part := range strings.Fields(q) {
+		term := SearchTerm{}
+		if name, value, ok := strings.Cut(part, ":"); ok {
+			field, known := searchFieldByName(strings.ToLower(name))
+			if !known {
+				return query, fmt.Errorf("неизвестное поле %q, допустимы: %s", name, strings.Join(searchFieldNames[:], ", "))
+			}
+			term.Field, term.Scoped, part = field, true, value
+		}
+		for _, token := range searchTokens(part) {
+			term.Token = token
+			query.Terms = append(query.Terms, term)
+		}
+	}
+	if len(query.Terms) == 0 {
+		return query, errors.New("запрос не содержит слов для поиска")
+	}
+	if len(query.Terms) > maxSearchTerms {
+		return query, fmt.Errorf("запрос содержит больше %d слов", maxSearchTerms)
+	}
+	return query, nil
+}
+
+// Функция получения поля поиска по имени
+func searchFieldByName(name string) (SearchField, bool) {
+	for field, fieldName := range searchFieldNames {
+		if fieldName == name {
+			return SearchField(field), true
+		}
+	}
+	return 0, false
+}
+
+// Функция разбиения текста на слова в нижнем регистре.
+// Текст делится по любому символу, не являющемуся буквой или цифрой. Анализатор PostgreSQL
+// с конфигурацией simple делит текст иначе: слово через дефис индексируется целиком и по частям
+// (coca-cola, coca, cola), а адреса сайтов и электронной почты и дробные числа остаются
+// одним словом (shop.example.com, user@mail.ru, 3.5). Поэтому, например, запрос com
+// находит в кеше заказ с брендом shop.example.com, а в PostgreSQL - нет.
+func searchTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Функция получения текста полей заказа для индексации
+func searchFieldTexts(order Order) [searchFieldCount][]string {
+	var texts [searchFieldCount][]string
+	for _, item := range order.Items {
+		texts[SearchBrand] = append(texts[SearchBrand], item.Brand)
+		texts[SearchItemName] = append(texts[SearchItemName], item.Name)
+	}
+	texts[SearchRecipient] = []string{order.Delivery.Name}
+	texts[SearchCity] = []string{order.Delivery.City}
+	return texts
+}
+
+// Инвертированный индекс слов заказов.
+// Для каждого поля хранятся количества вхождений слова в заказы и упорядоченный список
+// слов, по которому совпадения по префиксу находятся двоичным поиском.
+// Индекс не синхронизирован: в кеше он принадлежит сегменту и изменяется под его блокировкой.
+type textIndex struct {
+	postings [searchFieldCount]map[string]map[string]int // Слово -> order_uid -> количество вхождений
+	tokens   [searchFieldCount][]string                  // Упорядоченные слова postings
+}
+
+// Функция создания пустого инвертированного индекса
+func newTextIndex() *textIndex {
+	ix := &textIndex{}
+	for field := range ix.postings {
+		ix.postings[field] = make(map[string]map[string]int)
+	}
+	return ix
+}
+
+// Функция добавления слов заказа в индекс
+func (ix *textIndex) add(order Order) {
+	for field, texts := range searchFieldTexts(order) {
+		postings := ix.postings[field]
+		for _, text := range texts {
+			for _, token := range searchTokens(text) {
+				uids, ok := postings[token]
+				if !ok {
+					uids = make(map[string]int, 1)
+					postings[token] = uids
+					ix.tokens[field] = insertSorted(ix.tokens[field], token)
+				}
+				uids[order.OrderUID]++
+			}
+		}
+	}
+}
+
+// Функция удаления слов заказа из индекса. Заказ должен совпадать с добавленным.
+func (ix *textIndex) remove(order Order) {
+	for field, texts := range searchFieldTexts(order) {
+		postings := ix.postings[field]
+		for _, text := range texts {
+			for _, token := range searchTokens(text) {
+				uids, ok := postings[token]
+				if !ok {
+					continue
+				}
+				delete(uids, order.OrderUID)
+				if len(uids) == 0 {
+					delete(postings, token)
+					ix.tokens[field] = removeSorted(ix.tokens[field], token)
+				}
+			}
+		}
+	}
+}
+
+// Функция поиска заказов, содержащих все слова запроса.
+// Релевантность заказа - сумма по словам запроса весов полей, в которых найдено слово,
+// умноженных на 1+ln(количество вхождений); совпадение по префиксу весит вдвое меньше точного.
+// Это не формула ts_rank: PostgreSQL иначе учитывает повторы слова и не снижает вес
+// совпадения по префиксу, поэтому совпадают только веса полей, а не значения релевантности.
+func (ix *textIndex) search(terms []SearchTerm) map[string]float64 {
+	var scores map[string]float64
+	for _, term := range terms {
+		termScores := make(map[string]float64)
+		for field := SearchField(0); field < searchFieldCount; field++ {
+			if term.Scoped && term.Field != field {
+				continue
+			}
+			tokens := ix.tokens[field]
+			for i := sort.SearchStrings(tokens, term.Token); i < len(tokens) && strings.HasPrefix(tokens[i], term.Token); i++ {
+				weight := searchFieldWeights[field]
+				if tokens[i] != term.Token {
+					weight *= searchPrefixFactor
+				}
+				for uid, count := range ix.postings[field][tokens[i]] {
+					termScores[uid] += weight * (1 + math.Log(float64(count)))
+				}
+			}
+		}
+		// Остаются только заказы, содержащие все предыдущие слова
+		if scores != nil {
+			for uid, score := range termScores {
+				if prev, ok := scores[uid]; ok {
+					termScores[uid] = prev + score
+				} else {
+					delete(termScores, uid)
+				}
+			}
+		}
+		scores = termScores
+		if len(scores) == 0 {
+			break
+		}
+	}
+	return scores
+}
+
+// Найденный заказ с релевантностью
+type scoredOrder struct {
+	order Order
+	score float64
+}
+
+// Функция упорядочивания найденных заказов по релевантности и ограничения их количества
+func rankSearchResults(found []scoredOrder, limit int) []Order {
+	found = topSearchResults(found, limit)
+	orders := make([]Order, len(found))
+	for i, f := range found {
+		orders[i] = f.order
+	}
+	return orders
+}
+
+// Функция отбора не более limit самых релевантных заказов в порядке убывания релевантности
+func topSearchResults(found []scoredOrder, limit int) []scoredOrder {
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].score != found[j].score {
+			return found[i].score > found[j].score
+		}
+		return found[i].order.OrderUID < found[j].order.OrderUID
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found
+}
+
+// Функция построения выражения tsquery для PostgreSQL.
+// Слова состоят только из букв и цифр, поэтому кавычки в них не встречаются;
+// :* задаёт совпадение по префиксу, буква веса ограничивает поиск полем.
+func searchTSQuery(terms []SearchTerm) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = "'" + term.Token + "':*"
+		if term.Scoped {
+			parts[i] += searchFieldLabels[term.Field]
+		}
+	}
+	return strings.Join(parts, " & ")
+}
+
+// Функция вставки строки в упорядоченный срез
+func insertSorted(values []string, value string) []string {
+	i := sort.SearchStrings(values, value)
+	values = append(values, "")
+	copy(values[i+1:], values[i:])
+	values[i] = value
+	return values
+}
+
+// Функция удаления строки из упорядоченного среза
+func removeSorted(values []string, value string) []string {
+	i := sort.SearchStrings(values, value)
+	if i < len(values) && values[i] == value {
+		values = append(values[:i], values[i+1:]...)
+	}
+	return values
+}
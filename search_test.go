@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Функция создания заказа для поиска с указанными товарами (бренд, название) и городом
+func newSearchOrder(uid, city string, items ...[2]string) Order {
+	order := newTestOrder(uid)
+	order.Delivery.City = city
+	order.Items = nil
+	for _, item := range items {
+		order.Items = append(order.Items, Item{Brand: item[0], Name: item[1]})
+	}
+	return order
+}
+
+// Функция создания набора заказов для проверки поиска
+func searchTestOrders() []Order {
+	return []Order{
+		newSearchOrder("s-1", "Moscow", [2]string{"Nike", "Air Max sneakers"}),
+		newSearchOrder("s-2", "Nikel", [2]string{"Adidas", "Running shoes"}),
+		newSearchOrder("s-3", "Kazan", [2]string{"Nike", "Socks"}, [2]string{"Nike", "Cap"}),
+		newSearchOrder("s-4", "Moscow", [2]string{"Puma", "Nikelodeon T-shirt"}),
+		newSearchOrder("s-5", "Москва", [2]string{"Vivienne Sabo", "Тушь для ресниц"}),
+	}
+}
+
+// Функция получения order_uid найденных заказов через запятую
+func joinUIDs(orders []Order) string {
+	uids := make([]string, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+	}
+	return strings.Join(uids, ",")
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	query, err := parseSearchQuery("  Brand:Vivienne-Sabo  тушь ")
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+	want := []SearchTerm{
+		{Token: "vivienne", Field: SearchBrand, Scoped: true},
+		{Token: "sabo", Field: SearchBrand, Scoped: true},
+		{Token: "тушь"},
+	}
+	if len(query.Terms) != len(want) {
+		t.Fatalf("Ожидались слова %+v, получено: %+v", want, query.Terms)
+	}
+	for i := range want {
+		if query.Terms[i] != want[i] {
+			t.Errorf("Слово %d: ожидалось %+v, получено %+v", i, want[i], query.Terms[i])
+		}
+	}
+	if got := searchTSQuery(query.Terms); got != "'vivienne':*A & 'sabo':*A & 'тушь':*" {
+		t.Errorf("Неверный tsquery: %s", got)
+	}
+
+	for _, q := range []string{"", " ,. ", "color:red", strings.Repeat("a ", maxSearchTerms+1)} {
+		if _, err := parseSearchQuery(q); err == nil {
+			t.Errorf("Запрос %q: ожидалась ошибка", q)
+		}
+	}
+}
+
+// Известные расхождения поиска в кеше с PostgreSQL. Тест закрепляет поведение кеша;
+// лексемы PostgreSQL (to_tsvector('simple', text)) приведены для сравнения.
+func TestSearch_DifferencesFromPostgres(t *testing.T) {
+	tests := []struct {
+		text     string
+		cache    string
+		postgres string
+	}{
+		{"Nike Air", "nike air", "'air' 'nike'"},
+		{"Coca-Cola", "coca cola", "'coca' 'coca-cola' 'cola'"},
+		{"shop.example.com", "shop example com", "'shop.example.com'"},
+		{"user@mail.ru", "user mail ru", "'user@mail.ru'"},
+		{"3.5", "3 5", "'3.5'"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(searchTokens(tt.text), " "); got != tt.cache {
+			t.Errorf("Слова %q: ожидалось %q (в PostgreSQL %s), получено %q", tt.text, tt.cache, tt.postgres, got)
+		}
+	}
+
+	// Часть адреса сайта находится в кеше, хотя в PostgreSQL такого слова нет
+	ix := newTextIndex()
+	ix.add(newSearchOrder("d-1", "Kazan", [2]string{"shop.example.com", "Nike Nike"}))
+	if scores := ix.search([]SearchTerm{{Token: "com"}}); len(scores) != 1 {
+		t.Errorf("Ожидался заказ по части адреса сайта, получено: %v", scores)
+	}
+
+	// Релевантность: вес поля B, умноженный на 1+ln(2) за два вхождения, и половина веса за префикс.
+	// ts_rank для тех же данных даёт другие значения.
+	ranks := []struct {
+		token string
+		want  float64
+	}{
+		{"nike", 0.4 * (1 + math.Log(2))},
+		{"nik", 0.4 * searchPrefixFactor * (1 + math.Log(2))},
+	}
+	for _, tt := range ranks {
+		if got := ix.search([]SearchTerm{{Token: tt.token}})["d-1"]; math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Релевантность %q: ожидалось %.6f, получено %.6f", tt.token, tt.want, got)
+		}
+	}
+}
+
+func TestSearchOrders_CacheAndRepositories(t *testing.T) {
+	cache := newOrderCache(CacheConfig{Policy: EvictLRU, MaxEntries: 100, Shards: 4})
+	sqlite, err := newSQLiteRepository(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("Ошибка открытия SQLite: %v", err)
+	}
+	defer sqlite.Close()
+	searchers := map[string]interface {
+		OrderRepository
+		OrderSearcher
+	}{"память": newMemoryRepository(), "SQLite": sqlite}
+	for _, order := range searchTestOrders() {
+		cache.Set(order)
+		for _, r := range searchers {
+			r.Save(context.Background(), order, DuplicateIgnore)
+		}
+	}
+
+	cases := []struct {
+		q    string
+		want string
+	}{
+		// Два товара Nike весят больше одного, точное совпадение бренда - больше префикса в городе и названии
+		{"nike", "s-3,s-1,s-4,s-2"},
+		{"brand:nike", "s-3,s-1"},
+		{"city:nik", "s-2"},
+		{"nike moscow", "s-1,s-4"},
+		{"sneak", "s-1"},
+		{"москв тушь", "s-5"},
+		{"brand:vivienne name:тушь", "s-5"},
+		{"brand:тушь", ""},
+		{"reebok", ""},
+	}
+	for _, c := range cases {
+		query, err := parseSearchQuery(c.q)
+		if err != nil {
+			t.Fatalf("%q: ошибка разбора: %v", c.q, err)
+		}
+		query.Limit = 10
+		if got := joinUIDs(cache.Search(query)); got != c.want {
+			t.Errorf("%q, кеш: ожидалось %s, получено %s", c.q, c.want, got)
+		}
+		for name, r := range searchers {
+			found, err := r.Search(context.Background(), query)
+			if got := joinUIDs(found); err != nil || got != c.want {
+				t.Errorf("%q, хранилище %s: ожидалось %s, получено %s, ошибка %v", c.q, name, c.want, got, err)
+			}
+		}
+	}
+
+	query, _ := parseSearchQuery("nike")
+	query.Limit = 2
+	if got := joinUIDs(cache.Search(query)); got != "s-3,s-1" {
+		t.Errorf("Ожидались два самых релевантных заказа, получено: %s", got)
+	}
+	if found, _ := sqlite.Search(context.Background(), query); joinUIDs(found) != "s-3,s-1" {
+		t.Errorf("SQLite: ожидались два самых релевантных заказа, получено: %s", joinUIDs(found))
+	}
+}
+
+func TestSearchOrders_IndexFollowsCache(t *testing.T) {
+	cache := newOrderCache(CacheConfig{Policy: EvictLRU, MaxEntries: 2, Shards: 1})
+	cache.Set(newSearchOrder("a", "Moscow", [2]string{"Nike", "Cap"}))
+	cache.Set(newSearchOrder("b", "Kazan", [2]string{"Puma", "Cap"}))
+
+	search := func(q string) string {
+		query, _ := parseSearchQuery(q)
+		query.Limit = 10
+		return joinUIDs(cache.Search(query))
+	}
+
+	// Замена заказа убирает из индекса слова прежней версии
+	cache.Set(newSearchOrder("a", "Moscow", [2]string{"Adidas", "Cap"}))
+	if got := search("nike"); got != "" {
+		t.Errorf("После замены заказ не должен находиться по прежнему бренду, получено: %s", got)
+	}
+	if got := search("adidas"); got != "a" {
+		t.Errorf("После замены ожидался a по новому бренду, получено: %s", got)
+	}
+
+	// Вытесненный и удалённый заказы не находятся, а слова удаляются из индекса
+	cache.Set(newSearchOrder("c", "Kazan", [2]string{"Puma", "Hat"})) // Вытесняется b
+	cache.Delete("a")
+	if got := search("cap"); got != "" {
+		t.Errorf("Вытесненные и удалённые заказы не должны находиться, получено: %s", got)
+	}
+	text := cache.shards[0].text
+	if tokens := text.tokens[SearchBrand]; strings.Join(tokens, ",") != "puma" {
+		t.Errorf("В индексе брендов ожидалось только puma, получено: %v", tokens)
+	}
+	if tokens := text.tokens[SearchItemName]; strings.Join(tokens, ",") != "hat" {
+		t.Errorf("В индексе названий ожидалось только hat, получено: %v", tokens)
+	}
+}
+
+func TestAPISearchOrders(t *testing.T) {
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	useTestCache(t)
+	for i, order := range searchTestOrders() {
+		r.Save(context.Background(), order, DuplicateIgnore)
+		// В кеше только часть заказов
+		if i < 2 {
+			orderCache.Set(order)
+		}
+	}
+	mux := newTestAPIMux()
+
+	for _, c := range []struct {
+		target, want, source string
+	}{
+		{"/api/v1/orders/search?q=nike&limit=2", "s-1,s-2", listSourceCache},
+		{"/api/v1/orders/search?q=nike", "s-3,s-1,s-4,s-2", listSourceDB},
+		{"/api/v1/orders/search?q=nike&source=cache", "s-1,s-2", listSourceCache},
+		{"/api/v1/orders/search?q=brand:nike&source=db", "s-3,s-1", listSourceDB},
+	} {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, c.target, nil))
+		var results searchResults
+		if err := json.Unmarshal(recorder.Body.Bytes(), &results); err != nil || recorder.Code != http.StatusOK {
+			t.Fatalf("%s: код %d, ошибка %v", c.target, recorder.Code, err)
+		}
+		if got := joinUIDs(results.Orders); got != c.want || results.Source != c.source {
+			t.Errorf("%s: ожидалось %s из %s, получено %s из %s", c.target, c.want, c.source, got, results.Source)
+		}
+	}
+
+	for _, target := range []string{
+		"/api/v1/orders/search",
+		"/api/v1/orders/search?q=color:red",
+		"/api/v1/orders/search?q=nike&limit=1000",
+		"/api/v1/orders/search?q=nike&source=disk",
+	} {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: ожидался код %d, получено %d", target, http.StatusBadRequest, recorder.Code)
+		}
+		expectAPIError(t, recorder, errCodeInvalidParameter)
+	}
+}
@@ -1,39 +1,62 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"strconv"
 	"time"
-
-	"github.com/nats-io/stan.go"
 )
 
-func sender() {
-	sc, err := stan.Connect(clusterID, "cliend_id_1")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer sc.Close()
+// Функция периодической отправки тестовых заказов до отмены ctx.
+// Генератор подключается к транспорту, пока включён sender.enabled, и отключается,
+// когда его выключают перезагрузкой конфигурации.
+func sender(ctx context.Context) {
+	var publisher orderPublisher
+	defer func() {
+		if publisher != nil {
+			publisher.Close()
+		}
+	}()
 
-	ticker := time.NewTicker(10 * time.Second)
+	// Интервал и включение генератора перечитываются на каждой итерации,
+	// чтобы изменения конфигурации применялись без перезапуска
+	cfg := currentConfig()
+	timer := time.NewTimer(cfg.Sender.Interval)
+	defer timer.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			cfg = currentConfig()
+			timer.Reset(cfg.Sender.Interval)
+			if !cfg.Sender.Enabled {
+				if publisher != nil {
+					publisher.Close()
+					publisher = nil
+					log.Println("Генератор тестовых заказов остановлен")
+				}
+				continue
+			}
+			if publisher == nil {
+				// Генератор публикует заказы через тот же транспорт, что и подписка;
+				// при ошибке подключение повторяется на следующей итерации
+				var err error
+				if publisher, err = newOrderPublisher(cfg.NATS, cfg.Sender.ClientID); err != nil {
+					publisher = nil
+					log.Printf("Ошибка подключения генератора тестовых заказов: %v", err)
+					continue
+				}
+				log.Println("Генератор тестовых заказов запущен")
+			}
+
 			orderData := Order{
 				OrderUID:    strconv.FormatInt(time.Now().UnixNano(), 10), // Генерация уникального идентификатора заказа
 				TrackNumber: "2",
 				Entry:       "3",
-				Delivery: struct {
-					Name    string `json:"name"`
-					Phone   string `json:"phone"`
-					Zip     string `json:"zip"`
-					City    string `json:"city"`
-					Address string `json:"address"`
-					Region  string `json:"region"`
-					Email   string `json:"email"`
-				}{
+				Delivery: Delivery{
 					Name:    "John Doe",
 					Phone:   "123-456-7890",
 					Zip:     "12345",
@@ -42,42 +65,19 @@ func sender() {
 					Region:  "Example Region",
 					Email:   "john@example.com",
 				},
-				Payment: struct {
-					Transaction  string  `json:"transaction"`
-					RequestID    string  `json:"request_id"`
-					Currency     string  `json:"currency"`
-					Provider     string  `json:"provider"`
-					Amount       float64 `json:"amount"`
-					PaymentDT    int64   `json:"payment_dt"`
-					Bank         string  `json:"bank"`
-					DeliveryCost float64 `json:"delivery_cost"`
-					GoodsTotal   float64 `json:"goods_total"`
-					CustomFee    float64 `json:"custom_fee"`
-				}{
+				Payment: Payment{
 					Transaction:  "your_transaction",
 					RequestID:    "your_request_id",
 					Currency:     "USD",
 					Provider:     "Example Provider",
-					Amount:       123.45,
+					Amount:       128.0,
 					PaymentDT:    time.Now().Unix(),
 					Bank:         "Example Bank",
 					DeliveryCost: 10.0,
-					GoodsTotal:   100.0,
+					GoodsTotal:   113.0, // Сумма total_price товаров
 					CustomFee:    5.0,
 				},
-				Items: []struct {
-					ChrtID      int     `json:"chrt_id"`
-					TrackNumber string  `json:"track_number"`
-					Price       float64 `json:"price"`
-					RID         string  `json:"rid"`
-					Name        string  `json:"name"`
-					Sale        int     `json:"sale"`
-					Size        string  `json:"size"`
-					TotalPrice  float64 `json:"total_price"`
-					NmID        int     `json:"nm_id"`
-					Brand       string  `json:"brand"`
-					Status      int     `json:"status"`
-				}{
+				Items: []Item{
 					{
 						ChrtID:      1,
 						TrackNumber: "item_track_number",
@@ -121,7 +121,7 @@ func sender() {
 				continue
 			}
 
-			err = sc.Publish(subject, orderJSON)
+			err = publisher.Publish(cfg.NATS.Subject, orderJSON)
 			if err != nil {
 				log.Println("Error publishing order:", err)
 				continue
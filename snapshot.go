@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Версия формата файла снимка
+const snapshotVersion = 1
+
+// Наибольшее количество заказов, под которое память выделяется заранее по заголовку снимка.
+// Заголовок повреждённого файла может содержать любое число, поэтому при большем количестве
+// срез растёт по мере чтения заказов.
+const snapshotPreallocOrders = 1 << 16
+
+// Снимок кеша хранится в сжатом gzip файле: первая строка - заголовок snapshotHeader
+// в JSON, за ней по одному заказу в JSON на строку. Количество заказов в заголовке
+// и контрольная сумма gzip позволяют обнаружить обрезанный или повреждённый файл.
+type snapshotHeader struct {
+	Version   int       `json:"version"`
+	Transport string    `json:"transport"`
+	Subject   string    `json:"subject"`
+	Sequence  uint64    `json:"sequence"` // Номер последнего обработанного сообщения на момент снимка
+	CreatedAt time.Time `json:"created_at"`
+	Orders    int       `json:"orders"`
+}
+
+// Номер последнего сообщения, обработанного и подтверждённого приёмом заказов
+var lastAppliedSequence atomic.Uint64
+
+// Функция учёта обработанного сообщения. Сообщения с меньшим номером, подтверждённые позже
+// (например после повторной доставки), номер не уменьшают.
+func markSequenceApplied(sequence uint64) {
+	for {
+		current := lastAppliedSequence.Load()
+		if sequence <= current || lastAppliedSequence.CompareAndSwap(current, sequence) {
+			return
+		}
+	}
+}
+
+// Функция записи снимка кеша в файл path.
+// Снимок сначала пишется во временный файл в том же каталоге и затем переименовывается,
+// поэтому при сбое во время записи предыдущий снимок остаётся целым.
+func writeSnapshot(path string, nats NATSConfig) (snapshotHeader, error) {
+	// Номер читается до копирования кеша: все заказы из сообщений до него уже в кеше
+	header := snapshotHeader{
+		Version:   snapshotVersion,
+		Transport: nats.Transport,
+		Subject:   nats.Subject,
+		Sequence:  lastAppliedSequence.Load(),
+		CreatedAt: time.Now().UTC(),
+	}
+	orders := orderCache.Orders()
+	header.Orders = len(orders)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return header, fmt.Errorf("ошибка создания файла снимка: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	buf := bufio.NewWriter(tmp)
+	zw := gzip.NewWriter(buf)
+	enc := json.NewEncoder(zw)
+	if err := enc.Encode(header); err != nil {
+		return header, fmt.Errorf("ошибка записи заголовка снимка: %w", err)
+	}
+	for _, order := range orders {
+		if err := enc.Encode(order); err != nil {
+			return header, fmt.Errorf("ошибка записи заказа %s в снимок: %w", order.OrderUID, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return header, fmt.Errorf("ошибка записи снимка: %w", err)
+	}
+	if err := buf.Flush(); err != nil {
+		return header, fmt.Errorf("ошибка записи снимка: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return header, fmt.Errorf("ошибка записи снимка на диск: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return header, fmt.Errorf("ошибка записи снимка: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return header, fmt.Errorf("ошибка замены файла снимка: %w", err)
+	}
+	return header, nil
+}
+
+// Функция чтения снимка из файла path. Заказы возвращаются только если файл прочитан
+// целиком без ошибок: повреждённый снимок не должен частично попасть в кеш.
+func readSnapshot(path string) (snapshotHeader, []Order, error) {
+	var header snapshotHeader
+
+	f, err := os.Open(path)
+	if err != nil {
+		return header, nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return header, nil, fmt.Errorf("снимок повреждён: %w", err)
+	}
+	dec := json.NewDecoder(zr)
+	if err := dec.Decode(&header); err != nil {
+		return header, nil, fmt.Errorf("снимок повреждён: ошибка чтения заголовка: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return header, nil, fmt.Errorf("неподдерживаемая версия снимка %d", header.Version)
+	}
+	if header.Orders < 0 {
+		return header, nil, fmt.Errorf("снимок повреждён: отрицательное количество заказов %d", header.Orders)
+	}
+
+	orders := make([]Order, 0, min(header.Orders, snapshotPreallocOrders))
+	for i := 0; i < header.Orders; i++ {
+		var order Order
+		if err := dec.Decode(&order); err != nil {
+			return header, nil, fmt.Errorf("снимок повреждён: ошибка чтения заказа %d из %d: %w", i+1, header.Orders, err)
+		}
+		orders = append(orders, order)
+	}
+	if dec.More() {
+		return header, nil, errors.New("снимок повреждён: заказов больше, чем указано в заголовке")
+	}
+	// Контрольная сумма gzip проверяется только при чтении до конца потока
+	if _, err := io.Copy(io.Discard, io.MultiReader(dec.Buffered(), zr)); err != nil {
+		return header, nil, fmt.Errorf("снимок повреждён: %w", err)
+	}
+	return header, orders, nil
+}
+
+// Статистика быстрого запуска из снимка
+type warmStartStats struct {
+	Sequence  uint64 // Номер сообщения, на котором сделан снимок
+	Loaded    int    // Количество заказов, загруженных из снимка
+	Replayed  int    // Количество сообщений, прочитанных после снимка
+	Refreshed int    // Количество заказов из этих сообщений, обновлённых из хранилища
+}
+
+// Функция быстрого запуска: кеш заполняется из снимка, затем читаются сообщения канала,
+// пришедшие после снимка, и затронутые ими заказы загружаются из хранилища.
+// Заказы берутся из хранилища, а не из сообщений, потому что при политике ignore
+// или reject-if-different сохранённые данные могут отличаться от последнего сообщения.
+// Кеш собирается отдельно и заменяет orderCache только при успехе; при ошибке orderCache
+// не изменяется, и вызывающий должен восстановить его из базы данных.
+func warmStartFromSnapshot(ctx context.Context, consumer OrderConsumer) (warmStartStats, error) {
+	var stats warmStartStats
+	cfg := currentConfig()
+
+	header, orders, err := readSnapshot(cfg.Snapshot.Path)
+	if err != nil {
+		return stats, err
+	}
+	if header.Transport != cfg.NATS.Transport || header.Subject != cfg.NATS.Subject {
+		return stats, fmt.Errorf("снимок сделан для канала %s (транспорт %s), а не для %s (транспорт %s)",
+			header.Subject, header.Transport, cfg.NATS.Subject, cfg.NATS.Transport)
+	}
+	stats.Sequence = header.Sequence
+	cache := newOrderCache(cfg.Cache)
+	for _, order := range orders {
+		cache.Set(order)
+	}
+	stats.Loaded = len(orders)
+
+	replayCtx, cancel := context.WithTimeout(ctx, cfg.Snapshot.ReplayTimeout)
+	defer cancel()
+
+	changed := make(map[string]struct{})
+	err = consumer.Replay(replayCtx, replayPosition{Sequence: header.Sequence + 1}, func(msg *consumerMessage) {
+		stats.Replayed++
+		var order struct {
+			OrderUID string `json:"order_uid"`
+		}
+		if json.Unmarshal(msg.Data, &order) == nil && order.OrderUID != "" {
+			changed[order.OrderUID] = struct{}{}
+		}
+	})
+	if err != nil {
+		return stats, fmt.Errorf("ошибка чтения сообщений после снимка: %w", err)
+	}
+
+	// Отсутствие заказа в хранилище не ошибка: сообщение могло попасть в очередь отклонённых
+	// или ещё не быть обработанным, тогда заказ придёт через durable-подписку.
+	// Заказы загружаются пачками по restore.batch_size, чтобы не выполнять запрос на каждый заказ.
+	uids := make([]string, 0, len(changed))
+	for uid := range changed {
+		uids = append(uids, uid)
+	}
+	batchSize := max(cfg.Restore.BatchSize, 1)
+	for start := 0; start < len(uids); start += batchSize {
+		batch := uids[start:min(start+batchSize, len(uids))]
+		queryCtx, cancel := withQueryTimeout(ctx)
+		found, err := repo.GetMany(queryCtx, batch)
+		cancel()
+		if err != nil {
+			return stats, fmt.Errorf("ошибка загрузки заказов из хранилища: %w", err)
+		}
+		for _, order := range found {
+			cache.Set(order)
+			delete(changed, order.OrderUID)
+		}
+		stats.Refreshed += len(found)
+	}
+	for uid := range changed {
+		cache.Delete(uid)
+	}
+
+	orderCache = cache
+	markSequenceApplied(header.Sequence)
+	return stats, nil
+}
+
+// Функция периодической записи снимка кеша до отмены ctx.
+// Период перечитывается из конфигурации после каждой записи.
+func runSnapshots(ctx context.Context) {
+	cfg := currentConfig()
+	timer := time.NewTimer(cfg.Snapshot.Interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			cfg = currentConfig()
+			timer.Reset(cfg.Snapshot.Interval)
+			saveSnapshot(cfg)
+		}
+	}
+}
+
+// Функция записи снимка с выводом результата в журнал
+func saveSnapshot(cfg *Config) {
+	start := time.Now()
+	header, err := writeSnapshot(cfg.Snapshot.Path, cfg.NATS)
+	if err != nil {
+		log.Printf("Ошибка записи снимка кеша: %v", err)
+		return
+	}
+	log.Printf("Снимок кеша записан: заказов %d, сообщение %d, за %s", header.Orders, header.Sequence, time.Since(start).Round(time.Millisecond))
+}
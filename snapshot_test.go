@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Функция подмены кеша заказов на время теста
+func useTestCache(t *testing.T) {
+	previous := orderCache
+	orderCache = newOrderCache(defaultConfig().Cache)
+	t.Cleanup(func() { orderCache = previous })
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	useTestCache(t)
+	lastAppliedSequence.Store(0)
+	t.Cleanup(func() { lastAppliedSequence.Store(0) })
+
+	orderCache.Set(newTestOrder("snap-1"))
+	orderCache.Set(newTestOrder("snap-2"))
+	markSequenceApplied(42)
+	markSequenceApplied(17)
+
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	if _, err := writeSnapshot(path, defaultConfig().NATS); err != nil {
+		t.Fatalf("Ошибка записи снимка: %v", err)
+	}
+
+	header, orders, err := readSnapshot(path)
+	if err != nil {
+		t.Fatalf("Ошибка чтения снимка: %v", err)
+	}
+	if header.Sequence != 42 || header.Orders != 2 || len(orders) != 2 {
+		t.Errorf("Ожидался снимок из 2 заказов на сообщении 42, получено: %+v, заказов %d", header, len(orders))
+	}
+	for _, order := range orders {
+		if order.OrderUID != "snap-1" && order.OrderUID != "snap-2" {
+			t.Errorf("Неожиданный заказ в снимке: %s", order.OrderUID)
+		}
+	}
+}
+
+func TestReadSnapshot_Corrupt(t *testing.T) {
+	useTestCache(t)
+	for i := 0; i < 50; i++ {
+		orderCache.Set(newTestOrder(fmt.Sprintf("snap-%d", i)))
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.snapshot")
+	if _, err := writeSnapshot(path, defaultConfig().NATS); err != nil {
+		t.Fatalf("Ошибка записи снимка: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 0xff
+
+	cases := map[string][]byte{
+		"обрезанный":  data[:len(data)*2/3],
+		"без CRC":     data[:len(data)-4],
+		"изменённый":  flipped,
+		"не gzip":     []byte("{}\n"),
+		"пустой файл": nil,
+	}
+	for name, content := range cases {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, orders, err := readSnapshot(p); err == nil || orders != nil {
+			t.Errorf("%s: ожидалась ошибка чтения снимка, получено заказов %d", name, len(orders))
+		}
+	}
+
+	// Количество заказов в заголовке не должно приводить к выделению памяти под него
+	for _, count := range []int{-1, 1 << 40} {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		json.NewEncoder(zw).Encode(snapshotHeader{Version: snapshotVersion, Orders: count})
+		json.NewEncoder(zw).Encode(newTestOrder("snap-count"))
+		zw.Close()
+		p := filepath.Join(dir, fmt.Sprintf("count-%d", count))
+		if err := os.WriteFile(p, buf.Bytes(), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, orders, err := readSnapshot(p); err == nil || orders != nil {
+			t.Errorf("Заказов в заголовке %d: ожидалась ошибка чтения снимка, получено заказов %d", count, len(orders))
+		}
+	}
+}
+
+func TestWarmStartFromSnapshot(t *testing.T) {
+	useTestCache(t)
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	useTestConfig(t, func(cfg *Config) { cfg.Snapshot.Path = path })
+	t.Cleanup(func() { lastAppliedSequence.Store(0) })
+
+	// Снимок сделан на сообщении 10 и содержит устаревшие данные заказа warm-1
+	stale := newTestOrder("warm-1")
+	orderCache.Set(stale)
+	orderCache.Set(newTestOrder("warm-removed"))
+	lastAppliedSequence.Store(10)
+	if _, err := writeSnapshot(path, defaultConfig().NATS); err != nil {
+		t.Fatalf("Ошибка записи снимка: %v", err)
+	}
+	orderCache = newOrderCache(defaultConfig().Cache)
+
+	// После снимка заказ warm-1 изменён, добавлен warm-2, а warm-removed в хранилище отсутствует
+	updated := newTestOrder("warm-1")
+	updated.TrackNumber = "UPDATED"
+	r.Save(context.Background(), updated, DuplicateReplace)
+	r.Save(context.Background(), newTestOrder("warm-2"), DuplicateIgnore)
+
+	message := func(seq uint64, uid string) *consumerMessage {
+		data, _ := json.Marshal(newTestOrder(uid))
+		return &consumerMessage{Sequence: seq, Data: data}
+	}
+	consumer := &fakeConsumer{replay: []*consumerMessage{
+		message(9, "warm-old"), message(11, "warm-1"), message(12, "warm-2"), message(13, "warm-removed"),
+	}}
+
+	stats, err := warmStartFromSnapshot(context.Background(), consumer)
+	if err != nil {
+		t.Fatalf("Ошибка быстрого запуска: %v", err)
+	}
+	if stats.Loaded != 2 || stats.Replayed != 3 || stats.Refreshed != 2 {
+		t.Errorf("Неожиданная статистика быстрого запуска: %+v", stats)
+	}
+	if order, ok := orderCache.Get("warm-1"); !ok || order.TrackNumber != "UPDATED" {
+		t.Errorf("Заказ warm-1 не обновлён из хранилища: %+v", order)
+	}
+	if _, ok := orderCache.Get("warm-2"); !ok {
+		t.Error("Заказ warm-2 из сообщения после снимка отсутствует в кеше")
+	}
+	if _, ok := orderCache.Get("warm-removed"); ok {
+		t.Error("Заказ, отсутствующий в хранилище, остался в кеше")
+	}
+	if _, ok := orderCache.Get("warm-old"); ok {
+		t.Error("Сообщение до снимка не должно читаться повторно")
+	}
+	if got := lastAppliedSequence.Load(); got != 10 {
+		t.Errorf("Ожидался номер последнего сообщения 10, получено %d", got)
+	}
+}
+
+func TestWarmCache_DBKeepsStreamPosition(t *testing.T) {
+	useTestCache(t)
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	r.Save(context.Background(), newTestOrder("position-1"), DuplicateIgnore)
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	useTestConfig(t, func(cfg *Config) { cfg.Snapshot.Path = path })
+	lastAppliedSequence.Store(0)
+	t.Cleanup(func() { lastAppliedSequence.Store(0) })
+
+	// Снимок после восстановления из базы без новых сообщений начинается с последнего сообщения канала
+	warmCache(context.Background(), &fakeConsumer{replay: []*consumerMessage{{Sequence: 6}, {Sequence: 7}}})
+	header, err := writeSnapshot(path, defaultConfig().NATS)
+	if err != nil {
+		t.Fatalf("Ошибка записи снимка: %v", err)
+	}
+	if header.Sequence != 7 || header.Orders != 1 {
+		t.Errorf("Ожидался снимок с 1 заказом на сообщении 7, получено: %+v", header)
+	}
+}
+
+func TestWarmCache_FallbackToDB(t *testing.T) {
+	useTestCache(t)
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	r.Save(context.Background(), newTestOrder("fallback-1"), DuplicateIgnore)
+
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.snapshot")
+	os.WriteFile(corrupt, []byte("не снимок"), 0o600)
+
+	for name, path := range map[string]string{"нет файла": filepath.Join(dir, "missing"), "повреждён": corrupt} {
+		useTestConfig(t, func(cfg *Config) { cfg.Snapshot.Path = path })
+		orderCache = newOrderCache(defaultConfig().Cache)
+
+		if _, err := warmStartFromSnapshot(context.Background(), &fakeConsumer{}); err == nil {
+			t.Errorf("%s: ожидалась ошибка быстрого запуска", name)
+		}
+		warmCache(context.Background(), &fakeConsumer{})
+		if _, ok := orderCache.Get("fallback-1"); !ok {
+			t.Errorf("%s: кеш не восстановлен из базы данных", name)
+		}
+	}
+
+	// Ошибка чтения канала после снимка также приводит к восстановлению из базы
+	path := filepath.Join(dir, "cache.snapshot")
+	useTestConfig(t, func(cfg *Config) { cfg.Snapshot.Path = path })
+	orderCache = newOrderCache(defaultConfig().Cache)
+	orderCache.Set(newTestOrder("only-in-snapshot"))
+	if _, err := writeSnapshot(path, defaultConfig().NATS); err != nil {
+		t.Fatal(err)
+	}
+	orderCache = newOrderCache(defaultConfig().Cache)
+	consumer := &fakeConsumer{replayErr: errors.New("соединение потеряно")}
+
+	// Неудачный быстрый запуск не изменяет кеш
+	current := orderCache
+	if _, err := warmStartFromSnapshot(context.Background(), consumer); err == nil {
+		t.Error("Ожидалась ошибка быстрого запуска при ошибке чтения канала")
+	}
+	if orderCache != current || orderCache.Stats().Entries != 0 {
+		t.Error("Кеш изменён неудачным быстрым запуском")
+	}
+
+	warmCache(context.Background(), consumer)
+	if _, ok := orderCache.Get("only-in-snapshot"); ok {
+		t.Error("После ошибки чтения канала в кеше остались данные снимка")
+	}
+	if _, ok := orderCache.Get("fallback-1"); !ok {
+		t.Error("Кеш не восстановлен из базы данных после ошибки чтения канала")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Ошибка проверки одного поля заказа
+type FieldError struct {
+	Field   string `json:"field"`   // Путь к полю в JSON, например items[0].price
+	Code    string `json:"code"`    // Машиночитаемый код: required, format, range, mismatch
+	Message string `json:"message"` // Описание ошибки
+}
+
+// Ошибка проверки заказа со списком всех некорректных полей
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return "заказ не прошёл проверку: " + strings.Join(parts, "; ")
+}
+
+// Максимальная длина order_uid
+const maxOrderUIDLength = 128
+
+// Максимальная длина трек-номера
+const maxTrackNumberLength = 128
+
+// Допустимая погрешность при сравнении денежных сумм
+const moneyEpsilon = 0.005
+
+var (
+	phonePattern  = regexp.MustCompile(`^\+?[0-9][0-9 ()\-]{5,19}$`)
+	zipPattern    = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z \-]{1,9}$`)
+	localePattern = regexp.MustCompile(`^[a-z]{2,3}([_-][A-Z]{2})?$`)
+)
+
+// Действующие коды валют ISO 4217
+var currencyCodes = func() map[string]bool {
+	codes := make(map[string]bool)
+	for _, code := range strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB BRL BSD BTN BWP BYN BZD
+		CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD
+		GNF GTQ GYD HKD HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD KZT
+		LAK LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN NAD NGN NIO NOK NPR
+		NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP
+		STN SVC SYP SZL THB TJS TMT TND TOP TRY TTD TWD TZS UAH UGX USD UYU UZS VES VND VUV WST XAF XCD XOF
+		XPF YER ZAR ZMW ZWL`) {
+		codes[code] = true
+	}
+	return codes
+}()
+
+// Функция проверки заказа перед сохранением.
+// Возвращает *ValidationError со всеми найденными нарушениями или nil.
+func (o Order) Validate() error {
+	v := &validator{}
+
+	if code, message := orderUIDViolation(o.OrderUID); code != "" {
+		v.add("order_uid", code, message)
+	}
+	if code, message := trackNumberViolation(o.TrackNumber); code != "" {
+		v.add("track_number", code, message)
+	}
+	v.required("entry", o.Entry)
+	v.required("customer_id", o.CustomerID)
+	v.required("delivery_service", o.DeliveryService)
+	if v.required("locale", o.Locale) && !localePattern.MatchString(o.Locale) {
+		v.add("locale", "format", "ожидается код языка вида en или en_US")
+	}
+	if v.required("date_created", o.DateCreated) {
+		if _, err := time.Parse(time.RFC3339, o.DateCreated); err != nil {
+			v.add("date_created", "format", "ожидается дата в формате RFC3339")
+		}
+	}
+	v.nonNegative("sm_id", float64(o.SmID))
+
+	// Доставка
+	v.required("delivery.name", o.Delivery.Name)
+	v.required("delivery.city", o.Delivery.City)
+	v.required("delivery.address", o.Delivery.Address)
+	if v.required("delivery.phone", o.Delivery.Phone) && !phonePattern.MatchString(o.Delivery.Phone) {
+		v.add("delivery.phone", "format", "некорректный номер телефона")
+	}
+	if o.Delivery.Zip != "" && !zipPattern.MatchString(o.Delivery.Zip) {
+		v.add("delivery.zip", "format", "некорректный почтовый индекс")
+	}
+	if v.required("delivery.email", o.Delivery.Email) {
+		if addr, err := mail.ParseAddress(o.Delivery.Email); err != nil || addr.Address != o.Delivery.Email {
+			v.add("delivery.email", "format", "некорректный адрес электронной почты")
+		}
+	}
+
+	// Оплата
+	v.required("payment.transaction", o.Payment.Transaction)
+	v.required("payment.provider", o.Payment.Provider)
+	if v.required("payment.currency", o.Payment.Currency) && !currencyCodes[o.Payment.Currency] {
+		v.add("payment.currency", "format", "ожидается код валюты ISO 4217")
+	}
+	v.nonNegative("payment.amount", o.Payment.Amount)
+	v.nonNegative("payment.delivery_cost", o.Payment.DeliveryCost)
+	v.nonNegative("payment.goods_total", o.Payment.GoodsTotal)
+	v.nonNegative("payment.custom_fee", o.Payment.CustomFee)
+	if o.Payment.PaymentDT <= 0 {
+		v.add("payment.payment_dt", "range", "ожидается положительная отметка времени")
+	}
+
+	// Товары
+	if len(o.Items) == 0 {
+		v.add("items", "required", "заказ должен содержать хотя бы один товар")
+	}
+	var itemsTotal float64
+	for i, item := range o.Items {
+		prefix := fmt.Sprintf("items[%d].", i)
+		v.required(prefix+"rid", item.RID)
+		v.required(prefix+"name", item.Name)
+		v.required(prefix+"track_number", item.TrackNumber)
+		v.nonNegative(prefix+"chrt_id", float64(item.ChrtID))
+		v.nonNegative(prefix+"nm_id", float64(item.NmID))
+		v.nonNegative(prefix+"price", item.Price)
+		v.nonNegative(prefix+"total_price", item.TotalPrice)
+		v.nonNegative(prefix+"status", float64(item.Status))
+		if item.Sale < 0 || item.Sale > 100 {
+			v.add(prefix+"sale", "range", "скидка должна быть в диапазоне 0-100")
+		}
+		itemsTotal += item.TotalPrice
+	}
+
+	// Согласованность полей
+	if len(o.Items) > 0 && math.Abs(o.Payment.GoodsTotal-itemsTotal) > moneyEpsilon {
+		v.add("payment.goods_total", "mismatch",
+			fmt.Sprintf("сумма товаров %.2f не совпадает с суммой total_price товаров %.2f", o.Payment.GoodsTotal, itemsTotal))
+	}
+
+	if len(v.errors) > 0 {
+		return &ValidationError{Fields: v.errors}
+	}
+	return nil
+}
+
+// Накопитель ошибок проверки
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field, code, message string) {
+	v.errors = append(v.errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Проверка обязательного строкового поля, возвращает true если поле заполнено
+func (v *validator) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "required", "обязательное поле")
+		return false
+	}
+	return true
+}
+
+// Функция проверки идентификатора заказа. Одни и те же правила действуют
+// для сохраняемых заказов и для идентификаторов в запросах API, иначе заказ
+// можно сохранить, но нельзя запросить. Возвращает код и описание нарушения
+// или пустые строки, если идентификатор корректен.
+func orderUIDViolation(uid string) (code, message string) {
+	if uid == "" {
+		return "required", "Не указан идентификатор заказа"
+	}
+	if len(uid) > maxOrderUIDLength {
+		return "range", "Идентификатор заказа длиннее " + strconv.Itoa(maxOrderUIDLength) + " байт"
+	}
+	if strings.IndexFunc(uid, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return "format", "Идентификатор заказа содержит пробельные или управляющие символы"
+	}
+	return "", ""
+}
+
+// Функция проверки трек-номера заказа. В отличие от order_uid пробелы внутри трек-номера
+// допустимы, запрещены только управляющие символы. Возвращает код и описание нарушения
+// или пустые строки, если трек-номер корректен.
+func trackNumberViolation(track string) (code, message string) {
+	if strings.TrimSpace(track) == "" {
+		return "required", "Не указан трек-номер"
+	}
+	if len(track) > maxTrackNumberLength {
+		return "range", "Трек-номер длиннее " + strconv.Itoa(maxTrackNumberLength) + " байт"
+	}
+	if strings.IndexFunc(track, unicode.IsControl) >= 0 {
+		return "format", "Трек-номер содержит управляющие символы"
+	}
+	return "", ""
+}
+
+// Проверка, что числовое поле не отрицательно
+func (v *validator) nonNegative(field string, value float64) {
+	if value < 0 {
+		v.add(field, "range", "значение не может быть отрицательным")
+	}
+}
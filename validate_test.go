@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Функция поиска ошибки проверки по имени поля
+func findFieldError(err error, field string) (FieldError, bool) {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		return FieldError{}, false
+	}
+	for _, f := range validationErr.Fields {
+		if f.Field == field {
+			return f, true
+		}
+	}
+	return FieldError{}, false
+}
+
+func TestValidateOrder(t *testing.T) {
+	if err := newTestOrder("valid").Validate(); err != nil {
+		t.Fatalf("Корректный заказ не прошёл проверку: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(o *Order)
+		field  string
+		code   string
+	}{
+		{"пустой order_uid", func(o *Order) { o.OrderUID = "" }, "order_uid", "required"},
+		{"слишком длинный order_uid", func(o *Order) { o.OrderUID = strings.Repeat("a", maxOrderUIDLength+1) }, "order_uid", "range"},
+		{"пробел в order_uid", func(o *Order) { o.OrderUID = "order 1" }, "order_uid", "format"},
+		{"управляющий символ в order_uid", func(o *Order) { o.OrderUID = "order\x001" }, "order_uid", "format"},
+		{"управляющий символ в track_number", func(o *Order) { o.TrackNumber = "TRACK\n1" }, "track_number", "format"},
+		{"некорректный email", func(o *Order) { o.Delivery.Email = "not-an-email" }, "delivery.email", "format"},
+		{"некорректный телефон", func(o *Order) { o.Delivery.Phone = "phone" }, "delivery.phone", "format"},
+		{"некорректный индекс", func(o *Order) { o.Delivery.Zip = "#1" }, "delivery.zip", "format"},
+		{"дата не в RFC3339", func(o *Order) { o.DateCreated = "2021-11-26 06:22:19" }, "date_created", "format"},
+		{"неизвестная валюта", func(o *Order) { o.Payment.Currency = "usd" }, "payment.currency", "format"},
+		{"некорректная локаль", func(o *Order) { o.Locale = "english" }, "locale", "format"},
+		{"отрицательная сумма", func(o *Order) { o.Payment.Amount = -1 }, "payment.amount", "range"},
+		{"скидка больше 100", func(o *Order) { o.Items[0].Sale = 150 }, "items[0].sale", "range"},
+		{"нет товаров", func(o *Order) { o.Items = nil }, "items", "required"},
+		{"сумма товаров не совпадает", func(o *Order) { o.Payment.GoodsTotal = 1 }, "payment.goods_total", "mismatch"},
+	}
+	for _, tt := range tests {
+		order := newTestOrder("invalid")
+		tt.change(&order)
+		f, ok := findFieldError(order.Validate(), tt.field)
+		if !ok || f.Code != tt.code {
+			t.Errorf("%s: ожидалась ошибка %s для поля %s, получено: %+v", tt.name, tt.code, tt.field, f)
+		}
+	}
+
+	// Пустой заказ сообщает обо всех обязательных полях сразу
+	var validationErr *ValidationError
+	if err := (Order{}).Validate(); !errors.As(err, &validationErr) || len(validationErr.Fields) < 10 {
+		t.Errorf("Ожидался отчёт по всем обязательным полям, получено: %v", err)
+	}
+}
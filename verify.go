@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Заказ, данные которого в кеше отличаются от хранилища
+type orderDiff struct {
+	OrderUID string   `json:"order_uid"`
+	Fields   []string `json:"fields"` // Пути отличающихся полей, например payment.amount или items[0].price
+}
+
+// Отчёт о сверке кеша с хранилищем
+type consistencyReport struct {
+	StartedAt      time.Time `json:"started_at"`
+	Duration       string    `json:"duration"`
+	Cached         int       `json:"cached"`        // Заказов в кеше
+	Stored         int       `json:"stored"`        // Заказов в хранилище
+	Unreadable     int       `json:"unreadable"`    // Заказы хранилища, которые не удалось собрать
+	Consistent     int       `json:"consistent"`    // Заказы кеша, совпадающие с хранилищем
+	NotCached      int       `json:"not_cached"`    // Заказы хранилища, отсутствующие в ограниченном кеше, что не является ошибкой
+	MissingInDB    int       `json:"missing_in_db"` // Заказы кеша, которых нет в хранилище
+	StaleCount     int       `json:"stale"`         // Заказы кеша в более ранней версии, чем в хранилище
+	DivergentCount int       `json:"divergent"`     // Заказы кеша, отличающиеся от хранилища без более новой версии в нём
+
+	// Расхождения, не более reportSampleSize каждого вида
+	Missing   []string    `json:"missing_in_db_sample,omitempty"`
+	Stale     []orderDiff `json:"stale_sample,omitempty"`
+	Divergent []orderDiff `json:"divergent_sample,omitempty"`
+
+	// Результат исправления кеша, если оно запрошено
+	Repaired  bool `json:"repaired"`
+	Removed   int  `json:"removed"`   // Удалено из кеша заказов, которых нет в хранилище
+	Refreshed int  `json:"refreshed"` // Обновлено из хранилища заказов
+}
+
+// Функция проверки, что сверка обнаружила расхождения
+func (r *consistencyReport) Diverged() bool {
+	return r.MissingInDB > 0 || r.StaleCount > 0 || r.DivergentCount > 0
+}
+
+// Функция сверки содержимого кеша с хранилищем с поэлементным сравнением полей заказа.
+// Отличающиеся заказы делятся на два вида: устаревшие, если в хранилище более поздняя
+// по date_created версия и кеш пропустил её обновление, и расходящиеся - все остальные,
+// когда в кеше данные, которых в хранилище в таком виде не было.
+// Сообщения канала здесь не участвуют: канал сверяется с хранилищем при восстановлении
+// кеша из канала (restore.source: replay, отчёт GET /admin/recovery).
+// Все заказы хранилища читаются пачками по restore.batch_size. Сверка выполняется
+// без остановки приёма, поэтому заказ, сохранённый во время чтения, может оказаться
+// в числе расхождений; при исправлении каждый такой заказ перечитывается из хранилища,
+// и кеш изменяется только по его актуальному состоянию.
+func verifyCache(ctx context.Context, repair bool) (*consistencyReport, error) {
+	report := &consistencyReport{StartedAt: time.Now().UTC()}
+
+	cached := make(map[string]Order)
+	for _, order := range orderCache.Orders() {
+		cached[order.OrderUID] = order
+	}
+	report.Cached = len(cached)
+
+	var differ []string
+	err := repo.Stream(ctx, currentConfig().Restore.BatchSize, func(batch OrderBatch) error {
+		report.Stored += len(batch.Orders)
+		report.Unreadable += batch.Failed
+		for _, stored := range batch.Orders {
+			order, ok := cached[stored.OrderUID]
+			if !ok {
+				report.NotCached++
+				continue
+			}
+			delete(cached, stored.OrderUID)
+			fields := diffOrders(order, stored)
+			if len(fields) == 0 {
+				report.Consistent++
+				continue
+			}
+			differ = append(differ, stored.OrderUID)
+			diff := orderDiff{OrderUID: stored.OrderUID, Fields: fields}
+			if createdBefore(order, stored) {
+				report.StaleCount++
+				if len(report.Stale) < reportSampleSize {
+					report.Stale = append(report.Stale, diff)
+				}
+			} else {
+				report.DivergentCount++
+				if len(report.Divergent) < reportSampleSize {
+					report.Divergent = append(report.Divergent, diff)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения заказов из хранилища: %w", err)
+	}
+
+	missing := make([]string, 0, len(cached))
+	for uid := range cached {
+		missing = append(missing, uid)
+	}
+	report.MissingInDB = len(missing)
+	report.Missing = sampleUIDs(append([]string(nil), missing...))
+
+	if repair {
+		report.Repaired = true
+		for _, uid := range append(missing, differ...) {
+			if err := repairCachedOrder(ctx, uid, report); err != nil {
+				return report, err
+			}
+		}
+	}
+	report.Duration = time.Since(report.StartedAt).Round(time.Millisecond).String()
+	return report, nil
+}
+
+// Функция исправления одного заказа кеша по текущему состоянию хранилища
+func repairCachedOrder(ctx context.Context, uid string, report *consistencyReport) error {
+	queryCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	order, err := repo.Get(queryCtx, uid)
+	switch {
+	case err == nil:
+		updateOrderCache(order)
+		report.Refreshed++
+	case errors.Is(err, ErrOrderNotFound):
+		orderCache.Delete(uid)
+		report.Removed++
+	default:
+		return fmt.Errorf("ошибка загрузки заказа %s из хранилища: %w", uid, err)
+	}
+	return nil
+}
+
+// Функция проверки, что заказ a создан раньше заказа b по date_created.
+// Если дату не удаётся разобрать, порядок версий неизвестен и возвращается false.
+func createdBefore(a, b Order) bool {
+	ta, errA := time.Parse(time.RFC3339, a.DateCreated)
+	tb, errB := time.Parse(time.RFC3339, b.DateCreated)
+	return errA == nil && errB == nil && ta.Before(tb)
+}
+
+// Функция поэлементного сравнения заказов.
+// Возвращает пути отличающихся полей по именам из JSON-тегов.
+func diffOrders(a, b Order) []string {
+	var fields []string
+	diffValues("", reflect.ValueOf(a), reflect.ValueOf(b), &fields)
+	return fields
+}
+
+// Функция рекурсивного сравнения значений с накоплением путей отличающихся полей
+func diffValues(path string, a, b reflect.Value, fields *[]string) {
+	switch a.Kind() {
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			name, _, _ := strings.Cut(a.Type().Field(i).Tag.Get("json"), ",")
+			if path != "" {
+				name = path + "." + name
+			}
+			diffValues(name, a.Field(i), b.Field(i), fields)
+		}
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			*fields = append(*fields, path)
+			return
+		}
+		for i := 0; i < a.Len(); i++ {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), a.Index(i), b.Index(i), fields)
+		}
+	default:
+		if a.Interface() != b.Interface() {
+			*fields = append(*fields, path)
+		}
+	}
+}
+
+// Функция создания обработчика сверки кеша с хранилищем.
+// GET /admin/verify только сообщает о расхождениях, POST /admin/verify/repair
+// дополнительно исправляет кеш по данным хранилища. Сверка ограничена restore.timeout.
+func verifyCacheHandler(repair bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), currentConfig().Restore.Timeout)
+		defer cancel()
+
+		report, err := verifyCache(ctx, repair)
+		if err != nil {
+			log.Printf("Ошибка сверки кеша с хранилищем: %v", err)
+			writeAPIError(w, http.StatusServiceUnavailable, apiError{Code: errCodeStorageUnavailable, Message: "Сверка не выполнена: хранилище заказов недоступно"})
+			return
+		}
+		log.Printf("Сверка кеша с хранилищем: в кеше %d, совпадает %d, нет в хранилище %d, устарели %d, расходятся %d, исправлено %d",
+			report.Cached, report.Consistent, report.MissingInDB, report.StaleCount, report.DivergentCount, report.Removed+report.Refreshed)
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+// Функция выполнения подкоманды verify [repair].
+// Кеш находится в памяти работающего сервиса, поэтому сверку выполняет сервис,
+// а подкоманда обращается к нему по адресу http.addr и выводит отчёт.
+// Если расхождения найдены и не исправлены, возвращается ошибка.
+func runVerifyCommand(args []string) error {
+	cfg, rest, err := loadConfig(args)
+	if err != nil {
+		return err
+	}
+	method, path := http.MethodGet, "/admin/verify"
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 1 && rest[0] == "repair":
+		method, path = http.MethodPost, "/admin/verify/repair"
+	default:
+		return fmt.Errorf("неизвестные аргументы %v, допустимо: verify [repair]", rest)
+	}
+
+	host := cfg.HTTP.Addr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	req, err := http.NewRequest(method, "http://"+host+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Timeout: cfg.Restore.Timeout}).Do(req)
+	if err != nil {
+		return fmt.Errorf("сервис недоступен: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var envelope apiErrorEnvelope
+		if json.NewDecoder(resp.Body).Decode(&envelope) == nil && envelope.Error.Message != "" {
+			return fmt.Errorf("сервис вернул статус %s: %s", resp.Status, envelope.Error.Message)
+		}
+		return fmt.Errorf("сервис вернул статус %s", resp.Status)
+	}
+
+	var report consistencyReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return fmt.Errorf("ошибка разбора отчёта: %w", err)
+	}
+	printConsistencyReport(&report)
+	if report.Diverged() && !report.Repaired {
+		return errors.New("кеш расходится с хранилищем")
+	}
+	return nil
+}
+
+// Функция вывода отчёта о сверке
+func printConsistencyReport(report *consistencyReport) {
+	fmt.Fprintf(os.Stdout, "В кеше %d заказов, в хранилище %d (не удалось прочитать %d), не в кеше %d\n",
+		report.Cached, report.Stored, report.Unreadable, report.NotCached)
+	fmt.Fprintf(os.Stdout, "Совпадает %d, нет в хранилище %d, устарели %d, расходятся с хранилищем %d\n",
+		report.Consistent, report.MissingInDB, report.StaleCount, report.DivergentCount)
+	for _, uid := range report.Missing {
+		fmt.Fprintf(os.Stdout, "  нет в хранилище: %s\n", uid)
+	}
+	for _, order := range report.Stale {
+		fmt.Fprintf(os.Stdout, "  устарел: %s (%s)\n", order.OrderUID, strings.Join(order.Fields, ", "))
+	}
+	for _, order := range report.Divergent {
+		fmt.Fprintf(os.Stdout, "  расходится: %s (%s)\n", order.OrderUID, strings.Join(order.Fields, ", "))
+	}
+	if report.Repaired {
+		fmt.Fprintf(os.Stdout, "Кеш исправлен: удалено %d, обновлено %d\n", report.Removed, report.Refreshed)
+	}
+}
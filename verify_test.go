@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffOrders(t *testing.T) {
+	a := newTestOrder("diff")
+	if fields := diffOrders(a, newTestOrder("diff")); len(fields) != 0 {
+		t.Errorf("Одинаковые заказы не должны различаться, получено %v", fields)
+	}
+
+	b := newTestOrder("diff")
+	b.Payment.Amount++
+	b.Delivery.City = "Другой город"
+	b.Items[0].Price = 1
+	want := []string{"delivery.city", "payment.amount", "items[0].price"}
+	if fields := diffOrders(a, b); !reflect.DeepEqual(fields, want) {
+		t.Errorf("Ожидались отличия %v, получено %v", want, fields)
+	}
+
+	b = newTestOrder("diff")
+	b.Items = append(b.Items, b.Items[0])
+	if fields := diffOrders(a, b); !reflect.DeepEqual(fields, []string{"items"}) {
+		t.Errorf("Ожидалось отличие количества товаров, получено %v", fields)
+	}
+}
+
+// Функция подготовки кеша и хранилища с расхождениями:
+// verify-ok совпадает, verify-stale в кеше в более ранней версии, verify-divergent
+// отличается при той же дате создания, verify-missing есть только в кеше,
+// verify-db есть только в хранилище
+func setupDivergedCache(t *testing.T) {
+	useTestCache(t)
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+
+	ctx := context.Background()
+	for _, uid := range []string{"verify-ok", "verify-stale", "verify-divergent", "verify-db"} {
+		r.Save(ctx, newTestOrder(uid), DuplicateIgnore)
+	}
+	orderCache.Set(newTestOrder("verify-ok"))
+	stale := newTestOrder("verify-stale")
+	stale.TrackNumber = "OUTDATED"
+	stale.DateCreated = "2021-11-25T06:22:19Z"
+	orderCache.Set(stale)
+	divergent := newTestOrder("verify-divergent")
+	divergent.Payment.Amount = 1
+	orderCache.Set(divergent)
+	orderCache.Set(newTestOrder("verify-missing"))
+}
+
+func TestVerifyCache(t *testing.T) {
+	setupDivergedCache(t)
+
+	report, err := verifyCache(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Ошибка сверки: %v", err)
+	}
+	if report.Cached != 4 || report.Stored != 4 || report.Consistent != 1 || report.NotCached != 1 {
+		t.Errorf("Неожиданный отчёт: %+v", report)
+	}
+	if !reflect.DeepEqual(report.Missing, []string{"verify-missing"}) {
+		t.Errorf("Ожидался отсутствующий в хранилище verify-missing, получено %v", report.Missing)
+	}
+	wantStale := []orderDiff{{OrderUID: "verify-stale", Fields: []string{"track_number", "date_created"}}}
+	if report.StaleCount != 1 || !reflect.DeepEqual(report.Stale, wantStale) {
+		t.Errorf("Ожидались устаревшие заказы %+v, получено %d: %+v", wantStale, report.StaleCount, report.Stale)
+	}
+	wantDivergent := []orderDiff{{OrderUID: "verify-divergent", Fields: []string{"payment.amount"}}}
+	if report.DivergentCount != 1 || !reflect.DeepEqual(report.Divergent, wantDivergent) {
+		t.Errorf("Ожидались расходящиеся заказы %+v, получено %d: %+v", wantDivergent, report.DivergentCount, report.Divergent)
+	}
+	if !report.Diverged() || report.Repaired {
+		t.Error("Сверка без исправления должна сообщать о расхождениях")
+	}
+	if _, ok := orderCache.Get("verify-missing"); !ok {
+		t.Error("Сверка без исправления не должна изменять кеш")
+	}
+}
+
+func TestVerifyCache_Repair(t *testing.T) {
+	setupDivergedCache(t)
+
+	report, err := verifyCache(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Ошибка сверки: %v", err)
+	}
+	if !report.Repaired || report.Removed != 1 || report.Refreshed != 2 {
+		t.Errorf("Неожиданный результат исправления: %+v", report)
+	}
+	if _, ok := orderCache.Get("verify-missing"); ok {
+		t.Error("Заказ, отсутствующий в хранилище, не удалён из кеша")
+	}
+	if order, _ := orderCache.Get("verify-stale"); order.TrackNumber == "OUTDATED" {
+		t.Error("Устаревший заказ не обновлён из хранилища")
+	}
+
+	report, err = verifyCache(context.Background(), false)
+	if err != nil || report.Diverged() {
+		t.Errorf("После исправления расхождений быть не должно: %+v, ошибка %v", report, err)
+	}
+}
+
+func TestRunVerifyCommand(t *testing.T) {
+	setupDivergedCache(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/verify", verifyCacheHandler(false))
+	mux.HandleFunc("POST /admin/verify/repair", verifyCacheHandler(true))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	addr := "-http-addr=" + strings.TrimPrefix(server.URL, "http://")
+
+	if err := runVerifyCommand([]string{addr}); err == nil {
+		t.Error("При расхождениях подкоманда verify должна завершаться ошибкой")
+	}
+	if err := runVerifyCommand([]string{addr, "repair"}); err != nil {
+		t.Errorf("Ошибка исправления кеша: %v", err)
+	}
+	if err := runVerifyCommand([]string{addr}); err != nil {
+		t.Errorf("После исправления подкоманда verify не должна завершаться ошибкой: %v", err)
+	}
+	if err := runVerifyCommand([]string{addr, "fix"}); err == nil {
+		t.Error("Ожидалась ошибка для неизвестного аргумента")
+	}
+
+	rec := httptest.NewRecorder()
+	verifyCacheHandler(false)(rec, httptest.NewRequest(http.MethodGet, "/admin/verify", nil))
+	var report consistencyReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil || report.Cached != 3 {
+		t.Errorf("Неожиданный ответ обработчика: %+v, ошибка %v", report, err)
+	}
+
+	// Недоступное хранилище - ошибка в формате API, а не текст
+	useTestRepository(t, failingStreamRepository{})
+	rec = httptest.NewRecorder()
+	verifyCacheHandler(false)(rec, httptest.NewRequest(http.MethodGet, "/admin/verify", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Ожидался код состояния %d, получено: %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	expectAPIError(t, rec, errCodeStorageUnavailable)
+}
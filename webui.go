@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Страницы и статические файлы веб-интерфейса, встроенные в бинарный файл.
+// Интерфейс не использует внешних ресурсов и JavaScript.
+//
+//go:embed web
+var webFiles embed.FS
+
+// Способы поиска заказа в веб-интерфейсе
+const (
+	webSearchAuto  = ""      // Сначала по order_uid, затем по трек-номеру
+	webSearchUID   = "uid"   // Только по order_uid
+	webSearchTrack = "track" // Только по трек-номеру
+)
+
+// Максимальное количество заказов с одним трек-номером на странице
+const webTrackLimit = 50
+
+// Шаблоны страниц веб-интерфейса
+var webTemplates = template.Must(template.New("").Funcs(template.FuncMap{
+	"paymentTime": func(unix int64) string {
+		return time.Unix(unix, 0).UTC().Format("02.01.2006 15:04:05 UTC")
+	},
+	"createdTime": func(value string) string {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return value
+		}
+		return t.UTC().Format("02.01.2006 15:04:05 UTC")
+	},
+}).ParseFS(webFiles, "web/*.html"))
+
+// Данные страницы поиска заказа
+type webPage struct {
+	Query    string
+	By       string
+	Error    string  // Ошибка в запросе или хранилища
+	NotFound bool    // Поиск выполнен, но заказ не найден
+	Order    *Order  // Найденный заказ
+	Orders   []Order // Несколько заказов с одним трек-номером
+}
+
+// Функция регистрации обработчиков веб-интерфейса
+func registerWebUIHandlers(mux *http.ServeMux) {
+	static, _ := fs.Sub(webFiles, "web/static")
+	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServerFS(static)))
+	mux.HandleFunc("GET /{$}", webSearchHandler)
+}
+
+// Обработчик страницы поиска заказа по order_uid или трек-номеру (параметры q и by).
+// Найденный заказ показывается полностью, несколько заказов с одним трек-номером - списком
+// со ссылками на каждый.
+func webSearchHandler(w http.ResponseWriter, r *http.Request) {
+	page := webPage{
+		Query: strings.TrimSpace(r.URL.Query().Get("q")),
+		By:    r.URL.Query().Get("by"),
+	}
+	status := http.StatusOK
+	switch {
+	case page.By != webSearchAuto && page.By != webSearchUID && page.By != webSearchTrack:
+		page.Error, status = "Неизвестный способ поиска", http.StatusBadRequest
+	case page.Query == "" && !r.URL.Query().Has("q"):
+		// Первое открытие страницы: только форма поиска
+	default:
+		by, message := webSearchMode(page.By, page.Query)
+		if message != "" {
+			page.Error, status = message, http.StatusBadRequest
+			break
+		}
+		var err error
+		if status, err = findWebOrders(r.Context(), &page, by); err != nil {
+			log.Printf("Ошибка поиска заказа %q из веб-интерфейса: %v", page.Query, err)
+			page.Error = "Хранилище заказов недоступно, повторите запрос позже"
+		}
+	}
+	renderWebPage(w, status, &page)
+}
+
+// Функция выбора способа поиска с проверкой запроса по правилам этого способа.
+// Возвращает способ поиска и описание ошибки в запросе. При поиске везде значение,
+// которое не может быть order_uid (например трек-номер с пробелом), ищется только по трек-номеру.
+func webSearchMode(by, query string) (string, string) {
+	_, uidMessage := orderUIDViolation(query)
+	_, trackMessage := trackNumberViolation(query)
+	switch {
+	case by == webSearchUID:
+		return by, uidMessage
+	case by == webSearchTrack:
+		return by, trackMessage
+	case uidMessage == "":
+		return webSearchAuto, ""
+	case trackMessage == "":
+		return webSearchTrack, ""
+	}
+	return by, uidMessage
+}
+
+// Функция поиска заказов для страницы способом by. Заказ по order_uid берётся из кеша
+// или хранилища, как и в API; по трек-номеру заказы ищутся в хранилище.
+func findWebOrders(ctx context.Context, page *webPage, by string) (int, error) {
+	if by != webSearchTrack {
+		order, ok := orderCache.Get(page.Query)
+		if !ok {
+			var err error
+			order, err = loadOrder(ctx, page.Query)
+			if err != nil && !errors.Is(err, ErrOrderNotFound) {
+				return http.StatusServiceUnavailable, err
+			}
+			ok = err == nil
+		}
+		if ok {
+			page.Order = &order
+			return http.StatusOK, nil
+		}
+	}
+	if by != webSearchUID {
+		ctx, cancel := withQueryTimeout(ctx)
+		defer cancel()
+		orders, err := repo.List(ctx, ListQuery{Filter: OrderFilter{TrackNumber: page.Query}, Limit: webTrackLimit})
+		if err != nil {
+			return http.StatusServiceUnavailable, err
+		}
+		switch len(orders) {
+		case 0:
+		case 1:
+			page.Order = &orders[0]
+			return http.StatusOK, nil
+		default:
+			page.Orders = orders
+			return http.StatusOK, nil
+		}
+	}
+	page.NotFound = true
+	return http.StatusNotFound, nil
+}
+
+// Функция вывода страницы. Шаблон выполняется в буфер, чтобы ошибка шаблона
+// не оставила клиенту половину страницы с кодом 200.
+func renderWebPage(w http.ResponseWriter, status int, page *webPage) {
+	var buf bytes.Buffer
+	if err := webTemplates.ExecuteTemplate(&buf, "index.html", page); err != nil {
+		log.Printf("Ошибка формирования страницы: %v", err)
+		http.Error(w, "Ошибка формирования страницы", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
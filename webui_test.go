@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Функция выполнения запроса к веб-интерфейсу
+func getWebPage(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	registerWebUIHandlers(mux)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+// Функция проверки кода ответа и наличия фрагментов на странице
+func expectWebPage(t *testing.T, recorder *httptest.ResponseRecorder, status int, fragments ...string) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Errorf("Ожидался код %d, получено %d", status, recorder.Code)
+	}
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Ожидалась страница HTML, получено: %s", ct)
+	}
+	body := recorder.Body.String()
+	for _, fragment := range fragments {
+		if !strings.Contains(body, fragment) {
+			t.Errorf("На странице нет %q", fragment)
+		}
+	}
+}
+
+func TestWebUISearch(t *testing.T) {
+	r := newMemoryRepository()
+	useTestRepository(t, r)
+	useTestCache(t)
+	missingOrders = newNegativeCache()
+
+	single := newTestOrder("web-single")
+	single.TrackNumber = "WEBTRACK1"
+	r.Save(context.Background(), single, DuplicateIgnore)
+	for _, uid := range []string{"web-a", "web-b"} {
+		order := newTestOrder(uid)
+		order.TrackNumber = "WEBTRACK2"
+		r.Save(context.Background(), order, DuplicateIgnore)
+	}
+
+	spaced := newTestOrder("web-spaced")
+	spaced.TrackNumber = "WEB TRACK 3"
+	r.Save(context.Background(), spaced, DuplicateIgnore)
+
+	expectWebPage(t, getWebPage(t, "/"), http.StatusOK, `name="q"`, "Введите order_uid")
+
+	// По order_uid: доставка, оплата и товары
+	expectWebPage(t, getWebPage(t, "/?q=web-single"), http.StatusOK,
+		"Заказ web-single", "WEBTRACK1", "Kiryat Mozkin", "test@gmail.com", "wbpay", "1817 USD", "Mascaras", "Vivienne Sabo", "26.11.2021 06:22:19 UTC")
+	// По трек-номеру с одним заказом показывается сам заказ, с несколькими - список
+	expectWebPage(t, getWebPage(t, "/?q=WEBTRACK1&by=track"), http.StatusOK, "Заказ web-single")
+	expectWebPage(t, getWebPage(t, "/?q=WEBTRACK2"), http.StatusOK,
+		"Заказы с трек-номером WEBTRACK2", `href="/?by=uid&amp;q=web-a"`, `href="/?by=uid&amp;q=web-b"`)
+
+	expectWebPage(t, getWebPage(t, "/?q=WEBTRACK1&by=uid"), http.StatusNotFound, "Заказ не найден")
+
+	// Трек-номер проверяется по своим правилам: пробелы допустимы, управляющие символы - нет
+	expectWebPage(t, getWebPage(t, "/?q=WEB+TRACK+3&by=track"), http.StatusOK, "Заказ web-spaced")
+	expectWebPage(t, getWebPage(t, "/?q=WEB+TRACK+3"), http.StatusOK, "Заказ web-spaced")
+	expectWebPage(t, getWebPage(t, "/?q=WEB+TRACK+3&by=uid"), http.StatusBadRequest, "пробельные")
+	expectWebPage(t, getWebPage(t, "/?q=WEB%01TRACK&by=track"), http.StatusBadRequest, "Трек-номер содержит управляющие символы")
+	expectWebPage(t, getWebPage(t, "/?q=%20&by=track"), http.StatusBadRequest, "Не указан трек-номер")
+	expectWebPage(t, getWebPage(t, "/?q=nothing"), http.StatusNotFound, "Заказ не найден", "«nothing»")
+
+	// Ошибки в запросе и экранирование введённого значения
+	expectWebPage(t, getWebPage(t, "/?q="), http.StatusBadRequest, "Не указан идентификатор заказа")
+	expectWebPage(t, getWebPage(t, "/?q="+strings.Repeat("x", maxOrderUIDLength+1)), http.StatusBadRequest, "длиннее")
+	expectWebPage(t, getWebPage(t, "/?q=a&by=phone"), http.StatusBadRequest, "Неизвестный способ поиска")
+	recorder := getWebPage(t, "/?q=%3Cscript%3E")
+	expectWebPage(t, recorder, http.StatusNotFound, "&lt;script&gt;")
+	if strings.Contains(recorder.Body.String(), "<script>") {
+		t.Error("Введённое значение выведено без экранирования")
+	}
+
+	if recorder := getWebPage(t, "/unknown"); recorder.Code != http.StatusNotFound {
+		t.Errorf("Ожидался код %d для неизвестного адреса, получено %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestWebUIStaticFiles(t *testing.T) {
+	recorder := getWebPage(t, "/static/style.css")
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/css") {
+		t.Errorf("Ожидалась таблица стилей, получено: код %d, %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+
+	// Интерфейс не загружает внешние ресурсы и скрипты
+	fs.WalkDir(webFiles, "web", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, _ := fs.ReadFile(webFiles, path)
+		for _, forbidden := range []string{"http://", "https://", "<script"} {
+			if strings.Contains(string(data), forbidden) {
+				t.Errorf("%s содержит %q", path, forbidden)
+			}
+		}
+		return nil
+	})
+}